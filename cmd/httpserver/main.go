@@ -1,27 +1,136 @@
 package main
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"http-server/internal/fileserver"
+	"http-server/internal/headers"
+	"http-server/internal/request"
+	"http-server/internal/response"
+	"http-server/internal/router"
 	"http-server/internal/server"
 	"log"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 )
 
-const port = 42069
+const (
+	port            = 42069
+	shutdownTimeout = 10 * time.Second
+	staticDir       = "public"
+)
 
 func main() {
-	server, err := server.Serve(port)
+	r := router.New()
+	r.Handle("GET", "/", handler)
+	r.Handle("GET", "/stream", streamHandler)
+	r.Handle("GET", "/hello/{name}", helloHandler)
+
+	if fsys, err := fileserver.Dir(staticDir); err == nil {
+		files := fileserver.New(fsys)
+		files.Prefix = "/static"
+		files.Listing = true
+		r.Handle("GET", "/static/{path...}", files.ServeRequest)
+	} else {
+		log.Printf("Not serving static files: %v", err)
+	}
+
+	server, err := server.Serve(port, r.ServeRequest, func(s *server.Server) {
+		s.Middleware = []server.Middleware{logRequests}
+	})
 	if err != nil {
 		log.Fatalf("Error starting server: %v", err)
 	}
-	defer server.Close()
 	log.Println("Server started on port", port)
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 	<-sigChan
 	fmt.Println()
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Server stopped with requests still in flight: %v", err)
+		return
+	}
 	log.Println("Server gracefully stopped")
 }
+
+// Logs each request with its response status, size and duration
+func logRequests(next server.Handler) server.Handler {
+	return func(w *response.Writer, req *request.Request) {
+		start := time.Now()
+		next(w, req)
+		log.Printf("%s %s %d %dB %s", req.RequestLine.Method, req.RequestLine.RequestTarget,
+			w.StatusCode(), w.BytesWritten(), time.Since(start))
+	}
+}
+
+func handler(w *response.Writer, _ *request.Request) {
+	writeText(w, "Hello, World!\n")
+}
+
+func helloHandler(w *response.Writer, req *request.Request) {
+	writeText(w, fmt.Sprintf("Hello, %s!\n", req.PathValue("name")))
+}
+
+func writeText(w *response.Writer, text string) {
+	body := []byte(text)
+
+	if err := w.WriteStatusLine(response.StatusSuccess); err != nil {
+		log.Printf("Error writing status line: %v", err)
+		return
+	}
+
+	if err := w.WriteHeaders(response.GetDefaultHeaders(len(body))); err != nil {
+		log.Printf("Error writing headers: %v", err)
+		return
+	}
+
+	if _, err := w.WriteBody(body); err != nil {
+		log.Printf("Error writing body: %v", err)
+	}
+}
+
+// Streams a body of unknown length and sends its hash as a trailer
+func streamHandler(w *response.Writer, _ *request.Request) {
+	if err := w.WriteStatusLine(response.StatusSuccess); err != nil {
+		log.Printf("Error writing status line: %v", err)
+		return
+	}
+
+	h := headers.NewHeaders()
+	h.Set("Transfer-Encoding", "chunked")
+	h.Set("Trailer", "X-Content-SHA256")
+	if err := w.WriteHeaders(h); err != nil {
+		log.Printf("Error writing headers: %v", err)
+		return
+	}
+
+	hash := sha256.New()
+	for i := range 5 {
+		chunk := []byte(fmt.Sprintf("line %d\n", i+1))
+		hash.Write(chunk)
+		if _, err := w.WriteChunkedBody(chunk); err != nil {
+			log.Printf("Error writing body: %v", err)
+			return
+		}
+	}
+
+	if _, err := w.WriteChunkedBodyDone(); err != nil {
+		log.Printf("Error writing body: %v", err)
+		return
+	}
+
+	trailers := headers.NewHeaders()
+	trailers.Set("X-Content-SHA256", hex.EncodeToString(hash.Sum(nil)))
+	if err := w.WriteTrailers(trailers); err != nil {
+		log.Printf("Error writing trailers: %v", err)
+	}
+}
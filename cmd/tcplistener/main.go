@@ -22,13 +22,14 @@ func main() {
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
-			log.Fatalf("%s", err)
+			log.Printf("Error accepting connection: %s", err)
+			continue
 		}
 
 		reqLine, err := request.RequestFromReader(conn)
 
 		if err != nil {
-			log.Fatalf("%s", err)
+			log.Printf("Error parsing request from %s: %s", conn.RemoteAddr(), err)
 			conn.Close()
 			continue
 		}
@@ -36,7 +37,7 @@ func main() {
 		fmt.Printf("Request line:\n - Method: %s\n - Target: %s\n - Version: %s\n", reqLine.RequestLine.Method, reqLine.RequestLine.RequestTarget, reqLine.RequestLine.HttpVersion)
 
 		fmt.Printf("Headers:\n")
-		for key, value := range reqLine.Headers {
+		for key, value := range reqLine.Headers.All() {
 			fmt.Printf("- %s: %s\n", key, value)
 		}
 
@@ -0,0 +1,388 @@
+package fileserver
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	"http-server/internal/headers"
+	"http-server/internal/request"
+	"http-server/internal/response"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	indexFile  = "index.html"
+	copyBuffer = 32 * 1024
+)
+
+// FileServer serves the files of a file system, mapping the request path
+// to a file path
+type FileServer struct {
+	// Prefix is removed from the request path before it is mapped to a
+	// file, e.g. "/static" when mounted on "/static/{path...}". Requests
+	// outside the prefix get 404 Not Found.
+	Prefix string
+	// Listing renders an HTML list of the entries of directories without
+	// an index.html. Without it such directories get 404 Not Found.
+	Listing bool
+
+	fsys fs.FS
+}
+
+// New returns a file server for fsys
+func New(fsys fs.FS) *FileServer {
+	return &FileServer{fsys: fsys}
+}
+
+// Dir returns the file system rooted at dir. Neither ".." nor symbolic
+// links can reach files outside of dir.
+func Dir(dir string) (fs.FS, error) {
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open file server root: %w", err)
+	}
+	return root.FS(), nil
+}
+
+// ServeRequest is a server.Handler answering GET and HEAD requests with
+// the file named by the request path. Directories are served by their
+// index.html, or listed when Listing is set.
+func (f *FileServer) ServeRequest(w *response.Writer, req *request.Request) {
+	if req.RequestLine.Method != "GET" && req.RequestLine.Method != "HEAD" {
+		h := headers.NewHeaders()
+		h.Set("Allow", "GET, HEAD")
+		response.WriteStatus(w, response.StatusMethodNotAllowed, h)
+		return
+	}
+
+	name, ok := f.filePath(req.URL.Path)
+	if !ok {
+		response.WriteStatus(w, response.StatusNotFound, nil)
+		return
+	}
+
+	file, err := f.fsys.Open(name)
+	if err != nil {
+		writeFileError(w, err)
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		writeFileError(w, err)
+		return
+	}
+
+	if info.IsDir() {
+		f.serveDir(w, req, name)
+		return
+	}
+
+	// Cleaning dropped the trailing slash, but a file is not a directory
+	if strings.HasSuffix(req.URL.Path, "/") {
+		response.WriteStatus(w, response.StatusNotFound, nil)
+		return
+	}
+
+	serveFile(w, req, file, info)
+}
+
+// Maps the decoded request path to a file system path (see fs.ValidPath),
+// reporting false for paths outside Prefix. Cleaning the path as if it
+// were absolute drops any ".." that would climb above the root.
+func (f *FileServer) filePath(urlPath string) (string, bool) {
+	rest, ok := strings.CutPrefix(urlPath, strings.TrimSuffix(f.Prefix, "/"))
+	if !ok || (rest != "" && !strings.HasPrefix(rest, "/")) {
+		return "", false
+	}
+
+	// Backslashes and NUL bytes have special meanings on some platforms
+	if strings.ContainsAny(rest, "\\\x00") {
+		return "", false
+	}
+
+	name := strings.TrimPrefix(path.Clean("/"+rest), "/")
+	if name == "" {
+		name = "."
+	}
+	return name, fs.ValidPath(name)
+}
+
+func (f *FileServer) serveDir(w *response.Writer, req *request.Request, name string) {
+	// Relative links in the index only resolve against a path ending in a
+	// slash. The redirect is relative too, since a path like
+	// "//evil.example/.." would read as a link to another host.
+	if !strings.HasSuffix(req.URL.Path, "/") {
+		h := headers.NewHeaders()
+		h.Set("Location", "./"+escapePath(path.Base(req.URL.Path))+"/")
+		response.WriteStatus(w, response.StatusMovedPermanently, h)
+		return
+	}
+
+	index, err := f.fsys.Open(path.Join(name, indexFile))
+	if err == nil {
+		defer index.Close()
+
+		info, err := index.Stat()
+		if err == nil && !info.IsDir() {
+			serveFile(w, req, index, info)
+			return
+		}
+	}
+
+	if !f.Listing {
+		response.WriteStatus(w, response.StatusNotFound, nil)
+		return
+	}
+
+	entries, err := fs.ReadDir(f.fsys, name)
+	if err != nil {
+		writeFileError(w, err)
+		return
+	}
+
+	serveListing(w, req.URL.Path, entries)
+}
+
+// Streams the file body without holding it in memory, unless the
+// request's preconditions say the client's copy is current. Seekable files
+// also answer GET requests for byte ranges.
+func serveFile(w *response.Writer, req *request.Request, file fs.File, info fs.FileInfo) {
+	etag := fileETag(info)
+	if response.CheckPreconditions(w, req, etag, info.ModTime()) {
+		return
+	}
+
+	contentType, content, err := detectContentType(file, info.Name())
+	if err != nil {
+		writeFileError(w, err)
+		return
+	}
+
+	h := headers.NewHeaders()
+	response.SetValidators(h, etag, info.ModTime())
+
+	seeker, seekable := file.(io.Seeker)
+	if seekable {
+		h.Set("Accept-Ranges", "bytes")
+	}
+
+	// Range requests are only defined for GET (RFC 9110 section 14.2)
+	if seekable && req.RequestLine.Method == "GET" && req.Headers.Has("range") && response.IfRange(req, etag, info.ModTime()) {
+		ranges, err := response.ParseRange(req.Headers.Get("range"), info.Size())
+		if err != nil {
+			h.Set("Content-Range", fmt.Sprintf("bytes */%d", info.Size()))
+			response.WriteStatus(w, response.StatusRangeNotSatisfiable, h)
+			return
+		}
+
+		switch len(ranges) {
+		case 0:
+			// A unit other than bytes or ranges larger than the file are ignored
+		case 1:
+			serveRange(w, h, file, seeker, contentType, ranges[0], info.Size())
+			return
+		default:
+			serveRanges(w, h, file, seeker, contentType, ranges, info.Size())
+			return
+		}
+	}
+
+	if err := w.WriteStatusLine(response.StatusSuccess); err != nil {
+		log.Printf("Error writing status line: %v", err)
+		return
+	}
+
+	h.Set("Content-Type", contentType)
+	h.Set("Content-Length", strconv.FormatInt(info.Size(), 10))
+	if err := w.WriteHeaders(h); err != nil {
+		log.Printf("Error writing headers: %v", err)
+		return
+	}
+
+	if _, err := io.CopyBuffer(bodyWriter{w}, content, make([]byte, copyBuffer)); err != nil {
+		log.Printf("Error writing file %s: %v", info.Name(), err)
+	}
+}
+
+// Answers with a single part of the file
+func serveRange(w *response.Writer, h *headers.Headers, file fs.File, seeker io.Seeker, contentType string, r response.ByteRange, size int64) {
+	if err := w.WriteStatusLine(response.StatusPartialContent); err != nil {
+		log.Printf("Error writing status line: %v", err)
+		return
+	}
+
+	h.Set("Content-Type", contentType)
+	h.Set("Content-Range", r.ContentRange(size))
+	h.Set("Content-Length", strconv.FormatInt(r.Length, 10))
+	if err := w.WriteHeaders(h); err != nil {
+		log.Printf("Error writing headers: %v", err)
+		return
+	}
+
+	if err := copyRange(w, file, seeker, r, make([]byte, copyBuffer)); err != nil {
+		log.Printf("Error writing file range: %v", err)
+	}
+}
+
+// Answers with a multipart/byteranges body holding each range as a part
+// (RFC 9110 section 14.6). The part headers are built up front so the
+// body length is known.
+func serveRanges(w *response.Writer, h *headers.Headers, file fs.File, seeker io.Seeker, contentType string, ranges []response.ByteRange, size int64) {
+	boundary, err := newBoundary()
+	if err != nil {
+		log.Printf("Error creating multipart boundary: %v", err)
+		response.WriteStatus(w, response.StatusInternalError, nil)
+		return
+	}
+
+	partHeaders := make([]string, len(ranges))
+	length := int64(len("\r\n--" + boundary + "--\r\n"))
+	for i, r := range ranges {
+		// The delimiter of every part but the first ends the previous part's data
+		delimiter := "--" + boundary
+		if i > 0 {
+			delimiter = "\r\n" + delimiter
+		}
+		partHeaders[i] = delimiter + "\r\nContent-Type: " + contentType + "\r\nContent-Range: " + r.ContentRange(size) + "\r\n\r\n"
+		length += int64(len(partHeaders[i])) + r.Length
+	}
+
+	if err := w.WriteStatusLine(response.StatusPartialContent); err != nil {
+		log.Printf("Error writing status line: %v", err)
+		return
+	}
+
+	h.Set("Content-Type", "multipart/byteranges; boundary="+boundary)
+	h.Set("Content-Length", strconv.FormatInt(length, 10))
+	if err := w.WriteHeaders(h); err != nil {
+		log.Printf("Error writing headers: %v", err)
+		return
+	}
+
+	buf := make([]byte, copyBuffer)
+	for i, r := range ranges {
+		if _, err := w.WriteBody([]byte(partHeaders[i])); err != nil {
+			log.Printf("Error writing body: %v", err)
+			return
+		}
+		if err := copyRange(w, file, seeker, r, buf); err != nil {
+			log.Printf("Error writing file range: %v", err)
+			return
+		}
+	}
+
+	if _, err := w.WriteBody([]byte("\r\n--" + boundary + "--\r\n")); err != nil {
+		log.Printf("Error writing body: %v", err)
+	}
+}
+
+func copyRange(w *response.Writer, file fs.File, seeker io.Seeker, r response.ByteRange, buf []byte) error {
+	if _, err := seeker.Seek(r.Start, io.SeekStart); err != nil {
+		return err
+	}
+	_, err := io.CopyBuffer(bodyWriter{w}, io.LimitReader(file, r.Length), buf)
+	return err
+}
+
+// Returns a random boundary, which is vanishingly unlikely to occur in the file
+func newBoundary() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Returns a strong entity tag from the file's modification time and size,
+// which change whenever the file is rewritten
+func fileETag(info fs.FileInfo) string {
+	if info.ModTime().IsZero() {
+		return ""
+	}
+	return response.StrongETag(fmt.Sprintf("%x-%x", info.ModTime().UnixNano(), info.Size()))
+}
+
+func serveListing(w *response.Writer, urlPath string, entries []fs.DirEntry) {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	var b strings.Builder
+	title := html.EscapeString(urlPath)
+	fmt.Fprintf(&b, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>Index of %s</title>\n</head>\n<body>\n<h1>Index of %s</h1>\n<ul>\n", title, title)
+	if urlPath != "/" {
+		b.WriteString("<li><a href=\"../\">../</a></li>\n")
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() {
+			name += "/"
+		}
+		// "./" keeps names containing a colon from being read as a URL scheme
+		fmt.Fprintf(&b, "<li><a href=\"./%s\">%s</a></li>\n", html.EscapeString(escapePath(name)), html.EscapeString(name))
+	}
+	b.WriteString("</ul>\n</body>\n</html>\n")
+
+	body := []byte(b.String())
+	if err := w.WriteStatusLine(response.StatusSuccess); err != nil {
+		log.Printf("Error writing status line: %v", err)
+		return
+	}
+
+	h := headers.NewHeaders()
+	h.Set("Content-Type", "text/html; charset=utf-8")
+	h.Set("Content-Length", strconv.Itoa(len(body)))
+	if err := w.WriteHeaders(h); err != nil {
+		log.Printf("Error writing headers: %v", err)
+		return
+	}
+
+	if _, err := w.WriteBody(body); err != nil {
+		log.Printf("Error writing body: %v", err)
+	}
+}
+
+// Percent-encodes everything in a path segment but unreserved characters and "/"
+func escapePath(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || strings.IndexByte("-._~/", c) >= 0 {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+// bodyWriter adapts the response body to io.Writer
+type bodyWriter struct {
+	w *response.Writer
+}
+
+func (b bodyWriter) Write(p []byte) (int, error) {
+	return b.w.WriteBody(p)
+}
+
+// Answers a failure to open or read a file with the matching status
+func writeFileError(w *response.Writer, err error) {
+	switch {
+	case errors.Is(err, fs.ErrNotExist), errors.Is(err, fs.ErrInvalid):
+		response.WriteStatus(w, response.StatusNotFound, nil)
+	case errors.Is(err, fs.ErrPermission):
+		response.WriteStatus(w, response.StatusForbidden, nil)
+	default:
+		log.Printf("Error serving file: %v", err)
+		response.WriteStatus(w, response.StatusInternalError, nil)
+	}
+}
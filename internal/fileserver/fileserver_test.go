@@ -0,0 +1,332 @@
+package fileserver
+
+import (
+	"bytes"
+	"http-server/internal/request"
+	"http-server/internal/response"
+	"io"
+	"mime"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testFS = fstest.MapFS{
+	"hello.txt":         {Data: []byte("hello world\n")},
+	"style.css":         {Data: []byte("body {}")},
+	"noext":             {Data: []byte("<!DOCTYPE html><p>hi</p>")},
+	"blob":              {Data: []byte{0x00, 0x01, 0x02, 0xff}},
+	"image":             {Data: []byte("\x89PNG\r\n\x1a\nrest")},
+	"site/index.html":   {Data: []byte("<h1>index</h1>")},
+	"docs/a b.txt":      {Data: []byte("a")},
+	"docs/<script>.txt": {Data: []byte("x")},
+	"docs/nested/z.txt": {Data: []byte("z")},
+}
+
+// serve runs a request for target through fs and returns the raw response
+func serve(t *testing.T, fs *FileServer, method, target string) string {
+	t.Helper()
+	return serveWithFields(t, fs, method, target, "")
+}
+
+// serveWithFields is serve with extra request header lines, each ending in CRLF
+func serveWithFields(t *testing.T, fs *FileServer, method, target, fields string) string {
+	t.Helper()
+
+	req, err := request.RequestFromReader(strings.NewReader(method + " " + target + " HTTP/1.1\r\nHost: localhost\r\n" + fields + "\r\n"))
+	require.NoError(t, err)
+
+	buf := &bytes.Buffer{}
+	w := response.NewWriter(buf)
+	w.SetOmitBody(method == "HEAD")
+	fs.ServeRequest(w, req)
+	require.NoError(t, w.Finish())
+
+	return buf.String()
+}
+
+func body(out string) string {
+	_, b, _ := strings.Cut(out, "\r\n\r\n")
+	return b
+}
+
+func TestFileServer_ServesFiles(t *testing.T) {
+	testCases := []struct {
+		target      string
+		contentType string
+		body        string
+	}{
+		{target: "/hello.txt", contentType: "text/plain; charset=utf-8", body: "hello world\n"},
+		{target: "/style.css", contentType: "text/css; charset=utf-8", body: "body {}"},
+		{target: "/noext", contentType: "text/html; charset=utf-8", body: "<!DOCTYPE html><p>hi</p>"},
+		{target: "/blob", contentType: "application/octet-stream", body: "\x00\x01\x02\xff"},
+		{target: "/image", contentType: "image/png", body: "\x89PNG\r\n\x1a\nrest"},
+		{target: "/docs/a%20b.txt", contentType: "text/plain; charset=utf-8", body: "a"},
+		{target: "/site/", contentType: "text/html; charset=utf-8", body: "<h1>index</h1>"},
+		{target: "/site/index.html?v=2", contentType: "text/html; charset=utf-8", body: "<h1>index</h1>"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.target, func(t *testing.T) {
+			out := serve(t, New(testFS), "GET", tc.target)
+			assert.True(t, strings.HasPrefix(out, "HTTP/1.1 200 OK\r\n"), out)
+			assert.Contains(t, out, "Content-Type: "+tc.contentType+"\r\n")
+			assert.Equal(t, tc.body, body(out))
+		})
+	}
+}
+
+func TestFileServer_Head(t *testing.T) {
+	out := serve(t, New(testFS), "HEAD", "/hello.txt")
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nAccept-Ranges: bytes\r\nConnection: close\r\nContent-Length: 12\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n", out)
+}
+
+func TestFileServer_ConditionalRequests(t *testing.T) {
+	modTime := time.Date(2024, time.March, 10, 12, 0, 0, 0, time.UTC)
+	fsys := fstest.MapFS{"hello.txt": {Data: []byte("hello world\n"), ModTime: modTime}}
+	server := New(fsys)
+
+	out := serve(t, server, "GET", "/hello.txt")
+	etag := `"17bb656c74578000-c"`
+	assert.Contains(t, out, "ETag: "+etag+"\r\n")
+	assert.Contains(t, out, "Last-Modified: Sun, 10 Mar 2024 12:00:00 GMT\r\n")
+
+	testCases := []struct {
+		name     string
+		fields   string
+		expected string
+	}{
+		{name: "matching etag", fields: "If-None-Match: " + etag + "\r\n", expected: "HTTP/1.1 304 Not Modified\r\n"},
+		{name: "stale etag", fields: "If-None-Match: \"old\"\r\n", expected: "HTTP/1.1 200 OK\r\n"},
+		{name: "not modified since", fields: "If-Modified-Since: Sun, 10 Mar 2024 12:00:00 GMT\r\n", expected: "HTTP/1.1 304 Not Modified\r\n"},
+		{name: "modified since", fields: "If-Modified-Since: Sat, 09 Mar 2024 12:00:00 GMT\r\n", expected: "HTTP/1.1 200 OK\r\n"},
+		{name: "if-match fails", fields: "If-Match: \"old\"\r\n", expected: "HTTP/1.1 412 Precondition Failed\r\n"},
+		{name: "if-unmodified-since fails", fields: "If-Unmodified-Since: Sat, 09 Mar 2024 12:00:00 GMT\r\n", expected: "HTTP/1.1 412 Precondition Failed\r\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			out := serveWithFields(t, server, "GET", "/hello.txt", tc.fields)
+			assert.True(t, strings.HasPrefix(out, tc.expected), out)
+		})
+	}
+
+	out = serveWithFields(t, server, "GET", "/hello.txt", "If-None-Match: "+etag+"\r\n")
+	assert.Contains(t, out, "ETag: "+etag+"\r\n")
+	assert.NotContains(t, out, "Content-Type")
+	assert.Empty(t, body(out))
+}
+
+func TestFileServer_SingleRange(t *testing.T) {
+	testCases := []struct {
+		rangeValue   string
+		contentRange string
+		body         string
+	}{
+		{rangeValue: "bytes=0-4", contentRange: "bytes 0-4/12", body: "hello"},
+		{rangeValue: "bytes=6-", contentRange: "bytes 6-11/12", body: "world\n"},
+		{rangeValue: "bytes=-6", contentRange: "bytes 6-11/12", body: "world\n"},
+		{rangeValue: "bytes=6-100", contentRange: "bytes 6-11/12", body: "world\n"},
+		{rangeValue: "bytes=-100", contentRange: "bytes 0-11/12", body: "hello world\n"},
+		{rangeValue: "bytes=0-4, 20-30", contentRange: "bytes 0-4/12", body: "hello"},
+		{rangeValue: "bytes=3-6,0-4", contentRange: "bytes 0-6/12", body: "hello w"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.rangeValue, func(t *testing.T) {
+			out := serveWithFields(t, New(testFS), "GET", "/hello.txt", "Range: "+tc.rangeValue+"\r\n")
+			assert.True(t, strings.HasPrefix(out, "HTTP/1.1 206 Partial Content\r\n"), out)
+			assert.Contains(t, out, "Content-Range: "+tc.contentRange+"\r\n")
+			assert.Contains(t, out, "Content-Type: text/plain; charset=utf-8\r\n")
+			assert.Equal(t, tc.body, body(out))
+		})
+	}
+}
+
+func TestFileServer_MultipleRanges(t *testing.T) {
+	out := serveWithFields(t, New(testFS), "GET", "/hello.txt", "Range: bytes=0-4,-6\r\n")
+	require.True(t, strings.HasPrefix(out, "HTTP/1.1 206 Partial Content\r\n"), out)
+
+	_, rest, _ := strings.Cut(out, "Content-Type: ")
+	contentType, _, _ := strings.Cut(rest, "\r\n")
+	_, params, err := mime.ParseMediaType(contentType)
+	require.NoError(t, err)
+	boundary := params["boundary"]
+	require.NotEmpty(t, boundary)
+	assert.Contains(t, out, "Content-Type: multipart/byteranges; boundary="+boundary+"\r\n")
+
+	b := body(out)
+	assert.Contains(t, out, "Content-Length: "+strconv.Itoa(len(b))+"\r\n")
+
+	reader := multipart.NewReader(strings.NewReader(b), boundary)
+	expected := []struct{ contentRange, data string }{
+		{"bytes 0-4/12", "hello"},
+		{"bytes 6-11/12", "world\n"},
+	}
+	for _, part := range expected {
+		p, err := reader.NextPart()
+		require.NoError(t, err)
+		assert.Equal(t, part.contentRange, p.Header.Get("Content-Range"))
+		assert.Equal(t, "text/plain; charset=utf-8", p.Header.Get("Content-Type"))
+		data, err := io.ReadAll(p)
+		require.NoError(t, err)
+		assert.Equal(t, part.data, string(data))
+	}
+	_, err = reader.NextPart()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestFileServer_RangeNotSatisfiable(t *testing.T) {
+	for _, rangeValue := range []string{"bytes=12-", "bytes=-0", "bytes=5-2", "bytes=abc", "bytes="} {
+		t.Run(rangeValue, func(t *testing.T) {
+			out := serveWithFields(t, New(testFS), "GET", "/hello.txt", "Range: "+rangeValue+"\r\n")
+			assert.True(t, strings.HasPrefix(out, "HTTP/1.1 416 Range Not Satisfiable\r\n"), out)
+			assert.Contains(t, out, "Content-Range: bytes */12\r\n")
+		})
+	}
+}
+
+func TestFileServer_RangeIgnored(t *testing.T) {
+	modTime := time.Date(2024, time.March, 10, 12, 0, 0, 0, time.UTC)
+	fsys := fstest.MapFS{"hello.txt": {Data: []byte("hello world\n"), ModTime: modTime}}
+	etag := `"17bb656c74578000-c"`
+
+	testCases := []struct {
+		name     string
+		method   string
+		fields   string
+		expected string
+	}{
+		{name: "other unit", method: "GET", fields: "Range: items=0-4\r\n", expected: "HTTP/1.1 200 OK\r\n"},
+		{name: "ranges larger than file", method: "GET", fields: "Range: bytes=0-,0-,0-\r\n", expected: "HTTP/1.1 200 OK\r\n"},
+		{name: "head", method: "HEAD", fields: "Range: bytes=0-4\r\n", expected: "HTTP/1.1 200 OK\r\n"},
+		{name: "if-range stale etag", method: "GET", fields: "Range: bytes=0-4\r\nIf-Range: \"old\"\r\n", expected: "HTTP/1.1 200 OK\r\n"},
+		{name: "if-range stale date", method: "GET", fields: "Range: bytes=0-4\r\nIf-Range: Sat, 09 Mar 2024 12:00:00 GMT\r\n", expected: "HTTP/1.1 200 OK\r\n"},
+		{name: "if-range etag", method: "GET", fields: "Range: bytes=0-4\r\nIf-Range: " + etag + "\r\n", expected: "HTTP/1.1 206 Partial Content\r\n"},
+		{name: "if-range date", method: "GET", fields: "Range: bytes=0-4\r\nIf-Range: Sun, 10 Mar 2024 12:00:00 GMT\r\n", expected: "HTTP/1.1 206 Partial Content\r\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			out := serveWithFields(t, New(fsys), tc.method, "/hello.txt", tc.fields)
+			assert.True(t, strings.HasPrefix(out, tc.expected), out)
+		})
+	}
+}
+
+func TestFileServer_Errors(t *testing.T) {
+	testCases := []struct {
+		method   string
+		target   string
+		expected string
+	}{
+		{method: "GET", target: "/missing.txt", expected: "HTTP/1.1 404 Not Found\r\n"},
+		{method: "GET", target: "/hello.txt/", expected: "HTTP/1.1 404 Not Found\r\n"},
+		{method: "GET", target: "/docs/", expected: "HTTP/1.1 404 Not Found\r\n"},
+		{method: "GET", target: "/a%5Cb", expected: "HTTP/1.1 404 Not Found\r\n"},
+		{method: "GET", target: "/a%00b", expected: "HTTP/1.1 404 Not Found\r\n"},
+		{method: "POST", target: "/hello.txt", expected: "HTTP/1.1 405 Method Not Allowed\r\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.method+" "+tc.target, func(t *testing.T) {
+			out := serve(t, New(testFS), tc.method, tc.target)
+			assert.True(t, strings.HasPrefix(out, tc.expected), out)
+		})
+	}
+
+	out := serve(t, New(testFS), "PUT", "/hello.txt")
+	assert.Contains(t, out, "Allow: GET, HEAD\r\n")
+}
+
+func TestFileServer_DirectoryRedirect(t *testing.T) {
+	out := serve(t, New(testFS), "GET", "/site")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 301 Moved Permanently\r\n"), out)
+	assert.Contains(t, out, "Location: ./site/\r\n")
+
+	out = serve(t, New(testFS), "GET", "/docs/nested")
+	assert.Contains(t, out, "Location: ./nested/\r\n")
+
+	out = serve(t, &FileServer{Prefix: "/static", fsys: testFS}, "GET", "/static")
+	assert.Contains(t, out, "Location: ./static/\r\n")
+
+	// The target cleans to the root but must not redirect to another host
+	out = serve(t, New(testFS), "GET", "//evil.example/..")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 301 Moved Permanently\r\n"), out)
+	assert.NotContains(t, out, "Location: //")
+	assert.Contains(t, out, "Location: ./../\r\n")
+}
+
+func TestFileServer_Listing(t *testing.T) {
+	fsrv := New(testFS)
+	fsrv.Listing = true
+
+	out := serve(t, fsrv, "GET", "/docs/")
+	assert.Contains(t, out, "Content-Type: text/html; charset=utf-8\r\n")
+	assert.Contains(t, body(out), "<title>Index of /docs/</title>")
+	assert.Contains(t, body(out), `<li><a href="../">../</a></li>`)
+	assert.Contains(t, body(out), `<li><a href="./%3Cscript%3E.txt">&lt;script&gt;.txt</a></li>`)
+	assert.Contains(t, body(out), `<li><a href="./a%20b.txt">a b.txt</a></li>`)
+	assert.Contains(t, body(out), `<li><a href="./nested/">nested/</a></li>`)
+
+	// An index.html takes precedence over the listing
+	out = serve(t, fsrv, "GET", "/site/")
+	assert.Equal(t, "<h1>index</h1>", body(out))
+}
+
+func TestFileServer_Prefix(t *testing.T) {
+	fsrv := New(testFS)
+	fsrv.Prefix = "/static/"
+
+	assert.Equal(t, "hello world\n", body(serve(t, fsrv, "GET", "/static/hello.txt")))
+	assert.True(t, strings.HasPrefix(serve(t, fsrv, "GET", "/hello.txt"), "HTTP/1.1 404 Not Found\r\n"))
+	assert.True(t, strings.HasPrefix(serve(t, fsrv, "GET", "/statichello.txt"), "HTTP/1.1 404 Not Found\r\n"))
+}
+
+func TestFileServer_PathTraversal(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root")
+	require.NoError(t, os.Mkdir(root, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "secret.txt"), []byte("secret"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "public.txt"), []byte("public"), 0o644))
+	require.NoError(t, os.Symlink(filepath.Join(dir, "secret.txt"), filepath.Join(root, "link.txt")))
+
+	fsys, err := Dir(root)
+	require.NoError(t, err)
+	fsrv := New(fsys)
+
+	assert.Equal(t, "public", body(serve(t, fsrv, "GET", "/public.txt")))
+
+	for _, target := range []string{"/../secret.txt", "/%2E%2E/secret.txt", "/..%2Fsecret.txt", "/link.txt"} {
+		out := serve(t, fsrv, "GET", target)
+		assert.NotContains(t, out, "secret\n", target)
+		assert.NotEqual(t, "secret", body(out), target)
+	}
+}
+
+func TestSniff(t *testing.T) {
+	testCases := map[string]string{
+		"plain text":        "text/plain; charset=utf-8",
+		"  <html><body>":    "text/html; charset=utf-8",
+		"<?xml version=1?>": "text/xml; charset=utf-8",
+		"GIF89a....":        "image/gif",
+		"RIFF....WEBPVP8 ":  "image/webp",
+		"%PDF-1.7":          "application/pdf",
+		"bin\x00ary":        "application/octet-stream",
+		"caf\xc3":           "text/plain; charset=utf-8",
+		"bad \xff utf8":     "application/octet-stream",
+		"":                  "text/plain; charset=utf-8",
+	}
+
+	for data, expected := range testCases {
+		assert.Equal(t, expected, sniff([]byte(data)), data)
+	}
+}
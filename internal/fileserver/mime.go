@@ -0,0 +1,93 @@
+package fileserver
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"mime"
+	"path"
+	"unicode/utf8"
+)
+
+// Number of bytes looked at to guess the type of a file without a known extension
+const sniffLength = 512
+
+// Signatures of common file formats, checked in order
+var signatures = []struct {
+	prefix      []byte
+	contentType string
+}{
+	{[]byte("\x89PNG\r\n\x1a\n"), "image/png"},
+	{[]byte("\xff\xd8\xff"), "image/jpeg"},
+	{[]byte("GIF87a"), "image/gif"},
+	{[]byte("GIF89a"), "image/gif"},
+	{[]byte("%PDF-"), "application/pdf"},
+	{[]byte("PK\x03\x04"), "application/zip"},
+	{[]byte("\x1f\x8b\x08"), "application/gzip"},
+	{[]byte("\x00asm"), "application/wasm"},
+	{[]byte("wOF2"), "font/woff2"},
+	{[]byte("wOFF"), "font/woff"},
+}
+
+// Returns the content type of a file from its extension or, for unknown
+// extensions, from its first bytes. The returned reader yields the whole
+// file including any bytes read for sniffing.
+func detectContentType(file fs.File, name string) (string, io.Reader, error) {
+	if contentType := mime.TypeByExtension(path.Ext(name)); contentType != "" {
+		return contentType, file, nil
+	}
+
+	head := make([]byte, sniffLength)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", nil, err
+	}
+	head = head[:n]
+
+	return sniff(head), io.MultiReader(bytes.NewReader(head), file), nil
+}
+
+// Guesses the content type of data from well-known signatures, falling
+// back to plain text for UTF-8 without binary control characters
+func sniff(data []byte) string {
+	for _, sig := range signatures {
+		if bytes.HasPrefix(data, sig.prefix) {
+			return sig.contentType
+		}
+	}
+
+	if len(data) >= 12 && bytes.Equal(data[:4], []byte("RIFF")) && bytes.Equal(data[8:12], []byte("WEBP")) {
+		return "image/webp"
+	}
+
+	trimmed := bytes.ToLower(bytes.TrimLeft(data, "\t\n\x0c\r "))
+	for _, prefix := range []string{"<!doctype html", "<html", "<head", "<body"} {
+		if bytes.HasPrefix(trimmed, []byte(prefix)) {
+			return "text/html; charset=utf-8"
+		}
+	}
+	if bytes.HasPrefix(trimmed, []byte("<?xml")) {
+		return "text/xml; charset=utf-8"
+	}
+
+	if isText(data) {
+		return "text/plain; charset=utf-8"
+	}
+	return "application/octet-stream"
+}
+
+// Reports whether data is UTF-8 text. A multi-byte character cut off at
+// the end of the sniffed bytes is allowed.
+func isText(data []byte) bool {
+	for i := 0; i < len(data); {
+		r, size := utf8.DecodeRune(data[i:])
+		if r == utf8.RuneError && size <= 1 {
+			return len(data)-i < utf8.UTFMax && !utf8.FullRune(data[i:])
+		}
+		if r < ' ' && r != '\t' && r != '\n' && r != '\r' && r != '\x0c' {
+			return false
+		}
+		i += size
+	}
+	return true
+}
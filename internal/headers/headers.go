@@ -2,22 +2,43 @@ package headers
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"iter"
 	"regexp"
 	"strings"
 )
 
-type Headers map[string]string
+// Headers holds header fields in the order they were received or added.
+// Each field line is kept separately with the casing of its name, while
+// lookups are case-insensitive.
+type Headers struct {
+	fields []field
+}
+
+type field struct {
+	name  string
+	value string
+}
 
 const crlf = "\r\n"
 
-func NewHeaders() Headers {
+var (
+	// ErrMalformedHeader is returned for field lines that are not "name: value"
+	ErrMalformedHeader = errors.New("malformed header")
+	// ErrInvalidHeaderName is returned for field names with characters outside the token set
+	ErrInvalidHeaderName = errors.New("invalid header name")
+	// ErrHeaderTooLarge is returned when a header section exceeds the size the parser accepts
+	ErrHeaderTooLarge = errors.New("header fields too large")
+)
 
-	return make(Headers)
+func NewHeaders() *Headers {
+
+	return &Headers{}
 }
 
 // Parses the header line
-func (h Headers) Parse(data []byte) (n int, done bool, err error) {
+func (h *Headers) Parse(data []byte) (n int, done bool, err error) {
 
 	key, value, n, done, err := parseHeaderLine(data)
 	if err != nil {
@@ -25,11 +46,7 @@ func (h Headers) Parse(data []byte) (n int, done bool, err error) {
 	}
 
 	if key != "" {
-		if h.Has(key) {
-			h.Add(key, value)
-		} else {
-			h.Set(key, value)
-		}
+		h.Add(key, value)
 	}
 
 	return n, done, nil
@@ -58,7 +75,7 @@ func parseHeaderLine(content []byte) (key, value string, n int, done bool, err e
 	invalidChars := regexp.MustCompile(`[^a-zA-Z0-9!#$%&'*\+\-\.^_` + "`" + `|~]+`)
 
 	if invalidChars.MatchString(key) {
-		return "", "", 0, false, fmt.Errorf("invalid header name")
+		return "", "", 0, false, fmt.Errorf("%w: %q", ErrInvalidHeaderName, key)
 	}
 
 	return key, value, idx + len(crlf), false, nil
@@ -73,49 +90,162 @@ func headerLineExtractor(headerLine string) (key, value string, err error) {
 	parts := strings.SplitN(headerLine, ":", 2)
 
 	if len(parts) == 1 {
-		return "", "", fmt.Errorf("no split element found")
+		return "", "", fmt.Errorf("%w: no colon found", ErrMalformedHeader)
 	}
 
 	if parts[0] == "" {
-		return "", "", fmt.Errorf("empty key not allowed")
+		return "", "", fmt.Errorf("%w: empty key not allowed", ErrMalformedHeader)
 	}
 
 	if parts[0] != strings.TrimSpace(parts[0]) {
-		return "", "", fmt.Errorf("invalid header format: additional space detected")
+		return "", "", fmt.Errorf("%w: additional space detected", ErrMalformedHeader)
 	}
 
 	key, value = parts[0], strings.TrimSpace(parts[1])
 
+	for _, c := range []byte(value) {
+		if (c < ' ' && c != '\t') || c == 0x7f {
+			return "", "", fmt.Errorf("%w: control character in value of %s", ErrMalformedHeader, key)
+		}
+	}
+
 	return key, value, nil
 }
 
-// Set adds or updates a header (case-insensitive)
-func (h Headers) Set(key, value string) {
-	h[strings.ToLower(key)] = value
+// Set replaces every field line of a header with a single one (case-insensitive)
+func (h *Headers) Set(key, value string) {
+	for i := range h.fields {
+		if strings.EqualFold(h.fields[i].name, key) {
+			h.fields[i] = field{name: key, value: value}
+			h.deleteFrom(key, i+1)
+			return
+		}
+	}
+	h.fields = append(h.fields, field{name: key, value: value})
 }
 
-// Add appends a value to existing header or creates new one (case-insensitive)
-func (h Headers) Add(key, value string) {
-	lowerKey := strings.ToLower(key)
-	if existing, ok := h[lowerKey]; ok {
-		h[lowerKey] = existing + ", " + value
-	} else {
-		h[lowerKey] = value
+// Add appends a field line, keeping any existing ones for the same header
+func (h *Headers) Add(key, value string) {
+	h.fields = append(h.fields, field{name: key, value: value})
+}
+
+// Get retrieves header value (case-insensitive). Repeated field lines are
+// combined into one comma separated value, except for Set-Cookie whose
+// values may contain commas and which returns the first value.
+func (h *Headers) Get(key string) string {
+	values := h.Values(key)
+	if len(values) == 0 {
+		return ""
+	}
+	if strings.EqualFold(key, "set-cookie") {
+		return values[0]
 	}
+	return strings.Join(values, ", ")
 }
 
-// Get retrieves header value (case-insensitive)
-func (h Headers) Get(key string) string {
-	return h[strings.ToLower(key)]
+// Values returns the value of every field line of a header in order (case-insensitive)
+func (h *Headers) Values(key string) []string {
+	if h == nil {
+		return nil
+	}
+
+	var values []string
+	for _, f := range h.fields {
+		if strings.EqualFold(f.name, key) {
+			values = append(values, f.value)
+		}
+	}
+	return values
 }
 
 // Has checks if header exists (case-insensitive)
-func (h Headers) Has(key string) bool {
-	_, ok := h[strings.ToLower(key)]
-	return ok
+func (h *Headers) Has(key string) bool {
+	if h == nil {
+		return false
+	}
+
+	for _, f := range h.fields {
+		if strings.EqualFold(f.name, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// Delete removes every field line of a header (case-insensitive)
+func (h *Headers) Delete(key string) {
+	h.deleteFrom(key, 0)
 }
 
-// Delete removes header (case-insensitive)
-func (h Headers) Delete(key string) {
-	delete(h, strings.ToLower(key))
+// Removes the field lines of a header from index start on
+func (h *Headers) deleteFrom(key string, start int) {
+	kept := h.fields[:start]
+	for _, f := range h.fields[start:] {
+		if !strings.EqualFold(f.name, key) {
+			kept = append(kept, f)
+		}
+	}
+	clear(h.fields[len(kept):])
+	h.fields = kept
+}
+
+// Len returns the number of field lines
+func (h *Headers) Len() int {
+	if h == nil {
+		return 0
+	}
+	return len(h.fields)
+}
+
+// All iterates over the field lines in order, yielding each name with
+// its original casing and its value
+func (h *Headers) All() iter.Seq2[string, string] {
+	return func(yield func(string, string) bool) {
+		if h == nil {
+			return
+		}
+		for _, f := range h.fields {
+			if !yield(f.name, f.value) {
+				return
+			}
+		}
+	}
+}
+
+// Header names whose canonical form is not simple title case
+var canonicalExceptions = map[string]string{
+	"etag":             "ETag",
+	"www-authenticate": "WWW-Authenticate",
+	"content-md5":      "Content-MD5",
+	"dnt":              "DNT",
+	"te":               "TE",
+}
+
+// CanonicalKey returns the canonical form of a header name, e.g. content-type becomes Content-Type
+func CanonicalKey(key string) string {
+	lowerKey := strings.ToLower(key)
+	if canonical, ok := canonicalExceptions[lowerKey]; ok {
+		return canonical
+	}
+
+	upperNext := true
+	canonical := []byte(lowerKey)
+	for i, c := range canonical {
+		if upperNext && c >= 'a' && c <= 'z' {
+			canonical[i] = c - ('a' - 'A')
+		}
+		upperNext = c == '-'
+	}
+
+	return string(canonical)
+}
+
+// HasToken reports whether the comma separated header value contains token (case-insensitive)
+func (h *Headers) HasToken(key, token string) bool {
+	for _, value := range strings.Split(h.Get(key), ",") {
+		if strings.EqualFold(strings.TrimSpace(value), token) {
+			return true
+		}
+	}
+	return false
 }
@@ -14,7 +14,7 @@ func TestHeaders_ValidSingleHeader(t *testing.T) {
 	n, done, err := headers.Parse(data)
 	require.NoError(t, err)
 	require.NotNil(t, headers)
-	assert.Equal(t, "localhost:42069", headers["host"])
+	assert.Equal(t, "localhost:42069", headers.Get("host"))
 	assert.Equal(t, 23, n)
 	assert.False(t, done)
 }
@@ -24,7 +24,7 @@ func TestHeaders_HeaderWithNoSpaceAfterColon(t *testing.T) {
 	data := []byte("Host:localhost\r\n")
 	n, done, err := headers.Parse(data)
 	require.NoError(t, err)
-	assert.Equal(t, "localhost", headers["host"])
+	assert.Equal(t, "localhost", headers.Get("host"))
 	assert.Equal(t, 16, n)
 	assert.False(t, done)
 }
@@ -34,7 +34,7 @@ func TestHeaders_HeaderWithMultipleSpacesAfterColon(t *testing.T) {
 	data := []byte("Host:    localhost    \r\n")
 	n, done, err := headers.Parse(data)
 	require.NoError(t, err)
-	assert.Equal(t, "localhost", headers["host"])
+	assert.Equal(t, "localhost", headers.Get("host"))
 	assert.Equal(t, 24, n)
 	assert.False(t, done)
 }
@@ -44,7 +44,7 @@ func TestHeaders_HeaderWithComplexValue(t *testing.T) {
 	data := []byte("Accept: text/html, application/json, */*\r\n")
 	n, done, err := headers.Parse(data)
 	require.NoError(t, err)
-	assert.Equal(t, "text/html, application/json, */*", headers["accept"])
+	assert.Equal(t, "text/html, application/json, */*", headers.Get("accept"))
 	assert.Equal(t, 42, n)
 	assert.False(t, done)
 }
@@ -54,8 +54,8 @@ func TestHeaders_HeaderWithUppercaseKey(t *testing.T) {
 	data := []byte("HOST: localhost:4337\r\n")
 	n, done, err := headers.Parse(data)
 	require.NoError(t, err)
-	assert.Equal(t, "localhost:4337", headers["host"])
-	assert.Empty(t, headers["HOST"])
+	assert.Equal(t, "localhost:4337", headers.Get("host"))
+	assert.Equal(t, []string{"HOST"}, names(headers))
 	assert.Equal(t, len(data), n)
 	assert.False(t, done)
 }
@@ -65,7 +65,7 @@ func TestHeaders_EmptyValue(t *testing.T) {
 	data := []byte("Host:\r\n")
 	n, done, err := headers.Parse(data)
 	require.NoError(t, err)
-	assert.Equal(t, "", headers["host"])
+	assert.Equal(t, "", headers.Get("host"))
 	assert.Equal(t, 7, n)
 	assert.False(t, done)
 }
@@ -137,7 +137,7 @@ func TestHeaders_NoCRLFFound(t *testing.T) {
 
 // Header Methods Tests
 func TestHeaders_SetAndGetWithDifferentCases(t *testing.T) {
-	headers := make(Headers)
+	headers := NewHeaders()
 	headers.Set("Content-Type", "application/json")
 
 	// All these should return the same value
@@ -283,9 +283,99 @@ func TestHeaders_ValidHeaderFormats(t *testing.T) {
 			data := []byte(tc.data)
 			n, done, err := headers.Parse(data)
 			require.NoError(t, err)
-			assert.Equal(t, tc.expectedValue, headers[tc.expectedKey])
+			assert.Equal(t, tc.expectedValue, headers.Get(tc.expectedKey))
 			assert.Equal(t, tc.expectedBytes, n)
 			assert.False(t, done)
 		})
 	}
 }
+
+func TestHeaders_CanonicalKey(t *testing.T) {
+	testCases := map[string]string{
+		"content-type":     "Content-Type",
+		"CONTENT-LENGTH":   "Content-Length",
+		"x-forwarded-for":  "X-Forwarded-For",
+		"host":             "Host",
+		"etag":             "ETag",
+		"www-authenticate": "WWW-Authenticate",
+	}
+
+	for key, expected := range testCases {
+		assert.Equal(t, expected, CanonicalKey(key))
+	}
+}
+
+func TestHeaders_ErrorKinds(t *testing.T) {
+	testCases := []struct {
+		name     string
+		data     string
+		expected error
+	}{
+		{name: "missing colon", data: "Host localhost\r\n", expected: ErrMalformedHeader},
+		{name: "empty key", data: ": value\r\n", expected: ErrMalformedHeader},
+		{name: "space before colon", data: "Host : localhost\r\n", expected: ErrMalformedHeader},
+		{name: "control character in value", data: "Host: local\x00host\r\n", expected: ErrMalformedHeader},
+		{name: "invalid name character", data: "H©st: localhost\r\n", expected: ErrInvalidHeaderName},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			headers := NewHeaders()
+			_, _, err := headers.Parse([]byte(tc.data))
+			require.ErrorIs(t, err, tc.expected)
+		})
+	}
+}
+
+// names returns the name of every field line in order
+func names(h *Headers) []string {
+	var result []string
+	for name := range h.All() {
+		result = append(result, name)
+	}
+	return result
+}
+
+// Multi-Valued Header Tests
+func TestHeaders_RepeatedFieldsKeptInOrder(t *testing.T) {
+	headers := NewHeaders()
+	for _, line := range []string{
+		"Set-Cookie: a=1; Expires=Wed, 21 Oct 2026 07:28:00 GMT\r\n",
+		"Host: localhost\r\n",
+		"set-cookie: b=2\r\n",
+	} {
+		_, _, err := headers.Parse([]byte(line))
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, []string{"Set-Cookie", "Host", "set-cookie"}, names(headers))
+	assert.Equal(t, []string{"a=1; Expires=Wed, 21 Oct 2026 07:28:00 GMT", "b=2"}, headers.Values("SET-COOKIE"))
+	assert.Equal(t, "a=1; Expires=Wed, 21 Oct 2026 07:28:00 GMT", headers.Get("set-cookie"))
+	assert.Equal(t, 3, headers.Len())
+}
+
+func TestHeaders_SetReplacesAllFieldLines(t *testing.T) {
+	headers := NewHeaders()
+	headers.Add("Accept", "text/html")
+	headers.Add("Host", "localhost")
+	headers.Add("accept", "application/json")
+
+	headers.Set("ACCEPT", "*/*")
+	assert.Equal(t, []string{"ACCEPT", "Host"}, names(headers))
+	assert.Equal(t, []string{"*/*"}, headers.Values("accept"))
+
+	headers.Delete("accept")
+	assert.False(t, headers.Has("Accept"))
+	assert.Equal(t, []string{"Host"}, names(headers))
+	assert.Nil(t, headers.Values("accept"))
+}
+
+func TestHeaders_NilHeaders(t *testing.T) {
+	var headers *Headers
+
+	assert.Equal(t, "", headers.Get("host"))
+	assert.False(t, headers.Has("host"))
+	assert.Nil(t, headers.Values("host"))
+	assert.Equal(t, 0, headers.Len())
+	assert.Nil(t, names(headers))
+}
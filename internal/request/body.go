@@ -0,0 +1,105 @@
+package request
+
+import (
+	"bytes"
+	"errors"
+	"io"
+)
+
+// ErrBodyClosed is returned when reading from a streamed body after Close
+var ErrBodyClosed = errors.New("request body closed")
+
+// WithStreamingBody makes RequestFromReader return once the headers are
+// parsed, leaving the body to be read from Request.BodyReader
+func WithStreamingBody() Option {
+	return func(req *Request) {
+		req.streaming = true
+	}
+}
+
+func (req *Request) appendBody(data []byte) {
+	req.bodyRead += len(data)
+
+	if req.streaming {
+		req.pending = append(req.pending, data...)
+		return
+	}
+
+	req.Body = append(req.Body, data...)
+}
+
+// bodyReader decodes a streamed body on demand, reading at most one
+// buffer's worth of the connection ahead of the caller
+type bodyReader struct {
+	req    *Request
+	err    error
+	closed bool
+}
+
+func (b *bodyReader) Read(p []byte) (int, error) {
+	if b.closed {
+		return 0, ErrBodyClosed
+	}
+
+	if b.err != nil {
+		return 0, b.err
+	}
+
+	req := b.req
+	for len(req.pending) == 0 {
+		if req.state == requestStateDone {
+			return 0, io.EOF
+		}
+
+		if err := req.advance(); err != nil {
+			b.err = err
+			return 0, err
+		}
+	}
+
+	n := copy(p, req.pending)
+	req.pending = req.pending[n:]
+	if len(req.pending) == 0 {
+		req.pending = nil
+	}
+
+	return n, nil
+}
+
+// Close discards the rest of the body so the next request on the
+// connection can be read. It returns the error that stopped the body from
+// being read to the end, if any.
+func (b *bodyReader) Close() error {
+	if b.closed {
+		return b.err
+	}
+
+	_, err := io.Copy(io.Discard, b)
+	b.closed = true
+	if err != nil {
+		b.err = err
+	}
+
+	return b.err
+}
+
+// ReadBody reads the rest of a streamed body into Body, after which
+// BodyReader reads from memory as if WithStreamingBody was never given
+func (req *Request) ReadBody() error {
+	if !req.streaming {
+		return nil
+	}
+
+	body, err := io.ReadAll(req.BodyReader)
+	if err != nil {
+		return err
+	}
+
+	if len(body) > 0 {
+		req.Body = body
+	}
+	req.streaming = false
+	req.BodyReader = io.NopCloser(bytes.NewReader(req.Body))
+
+	return nil
+}
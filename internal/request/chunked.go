@@ -0,0 +1,120 @@
+package request
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Determines how the body is framed once all headers are parsed (RFC 9112 section 6.3)
+func (req *Request) bodyState() (State, error) {
+	transferEncoding, chunked := req.Headers.Get("transfer-encoding"), req.Headers.Has("transfer-encoding")
+	contentValue, hasContentLength := req.Headers.Get("content-length"), req.Headers.Has("content-length")
+
+	if chunked {
+		if hasContentLength {
+			return 0, fmt.Errorf("%w: both Transfer-Encoding and Content-Length headers present", ErrMalformedRequest)
+		}
+
+		codings := strings.Split(transferEncoding, ",")
+		for i, coding := range codings {
+			coding = strings.ToLower(strings.TrimSpace(coding))
+			if coding != "chunked" {
+				return 0, fmt.Errorf("%w: transfer coding %q", ErrNotImplemented, coding)
+			}
+			if i != len(codings)-1 {
+				return 0, fmt.Errorf("%w: chunked transfer coding applied more than once", ErrMalformedRequest)
+			}
+		}
+
+		return requestStateParsingChunkSize, nil
+	}
+
+	// Without framing headers the request has no body
+	if !hasContentLength {
+		return requestStateDone, nil
+	}
+
+	contentLength, err := strconv.Atoi(contentValue)
+	if errors.Is(err, strconv.ErrRange) {
+		return 0, fmt.Errorf("%w: Content-Length %s", ErrBodyTooLarge, contentValue)
+	}
+	if err != nil || contentLength < 0 || contentValue[0] == '+' {
+		return 0, fmt.Errorf("%w: malformed Content-Length header %q", ErrMalformedRequest, contentValue)
+	}
+
+	if err := req.checkBodyLength(contentLength); err != nil {
+		return 0, err
+	}
+
+	if contentLength == 0 {
+		return requestStateDone, nil
+	}
+
+	req.bodyLength = contentLength
+	return requestStateParsingBody, nil
+}
+
+// Parses a chunk-size line including optional chunk extensions, which are validated and ignored
+func parseChunkSize(content []byte) (size int, n int, err error) {
+	idx := bytes.Index(content, []byte(crlf))
+	if idx == -1 {
+		return 0, 0, nil
+	}
+
+	line := string(content[:idx])
+	sizePart, extensions, _ := strings.Cut(line, ";")
+
+	sizePart = strings.TrimRight(sizePart, " \t")
+	if sizePart == "" {
+		return 0, 0, fmt.Errorf("%w: missing chunk size", ErrMalformedBody)
+	}
+
+	chunkSize, err := strconv.ParseUint(sizePart, 16, 31)
+	if errors.Is(err, strconv.ErrRange) {
+		return 0, 0, fmt.Errorf("%w: chunk size %s", ErrBodyTooLarge, sizePart)
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: malformed chunk size %q", ErrMalformedBody, sizePart)
+	}
+
+	if extensions != "" {
+		for _, ext := range strings.Split(extensions, ";") {
+			name, _, _ := strings.Cut(ext, "=")
+			name = strings.Trim(name, " \t")
+			if !isToken(name) {
+				return 0, 0, fmt.Errorf("%w: malformed chunk extension %q", ErrMalformedBody, ext)
+			}
+		}
+	}
+
+	return int(chunkSize), idx + len(crlf), nil
+}
+
+// Reports whether s is a non-empty token as defined in RFC 9110 section 5.6.2
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+
+	for _, c := range []byte(s) {
+		if !isTokenChar(c) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isTokenChar(c byte) bool {
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		return true
+	case strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,71 @@
+package request
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrNoCookie is returned by Request.Cookie when the cookie is not present
+var ErrNoCookie = errors.New("named cookie not present")
+
+// Cookie is a name-value pair sent by the client in the Cookie header
+type Cookie struct {
+	Name  string
+	Value string
+}
+
+// Cookies parses the Cookie header fields into cookies in the order they
+// were sent (RFC 6265 section 5.4). Pairs with an invalid name or value
+// are skipped.
+func (req *Request) Cookies() []*Cookie {
+	var cookies []*Cookie
+
+	for _, line := range req.Headers.Values("cookie") {
+		for _, pair := range strings.Split(line, ";") {
+			name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if !ok || !isToken(name) {
+				continue
+			}
+
+			value, ok = parseCookieValue(value)
+			if !ok {
+				continue
+			}
+
+			cookies = append(cookies, &Cookie{Name: name, Value: value})
+		}
+	}
+
+	return cookies
+}
+
+// Cookie returns the first cookie with the given name
+func (req *Request) Cookie(name string) (*Cookie, error) {
+	for _, cookie := range req.Cookies() {
+		if cookie.Name == name {
+			return cookie, nil
+		}
+	}
+	return nil, ErrNoCookie
+}
+
+// Strips optional double quotes and validates the cookie-octets of a
+// cookie-value (RFC 6265 section 4.1.1)
+func parseCookieValue(value string) (string, bool) {
+	if len(value) > 1 && value[0] == '"' && value[len(value)-1] == '"' {
+		value = value[1 : len(value)-1]
+	}
+
+	for _, c := range []byte(value) {
+		if !isCookieOctet(c) {
+			return "", false
+		}
+	}
+
+	return value, true
+}
+
+// cookie-octet = %x21 / %x23-2B / %x2D-3A / %x3C-5B / %x5D-7E
+func isCookieOctet(c byte) bool {
+	return c >= 0x21 && c <= 0x7e && c != '"' && c != ',' && c != ';' && c != '\\'
+}
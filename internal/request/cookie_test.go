@@ -0,0 +1,37 @@
+package request
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequest_Cookies(t *testing.T) {
+	r, err := RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\nHost: localhost\r\n" +
+		"Cookie: session=abc123; theme=\"dark\"; empty=; bad name=x; novalue; bad=a,b\r\n" +
+		"Cookie: session=second\r\n\r\n"))
+	require.NoError(t, err)
+
+	assert.Equal(t, []*Cookie{
+		{Name: "session", Value: "abc123"},
+		{Name: "theme", Value: "dark"},
+		{Name: "empty", Value: ""},
+		{Name: "session", Value: "second"},
+	}, r.Cookies())
+
+	cookie, err := r.Cookie("session")
+	require.NoError(t, err)
+	assert.Equal(t, "abc123", cookie.Value)
+
+	_, err = r.Cookie("missing")
+	require.ErrorIs(t, err, ErrNoCookie)
+}
+
+func TestRequest_NoCookies(t *testing.T) {
+	r, err := RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+
+	assert.Empty(t, r.Cookies())
+}
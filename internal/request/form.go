@@ -0,0 +1,360 @@
+package request
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"http-server/internal/headers"
+	"io"
+	"mime"
+	"mime/multipart"
+	"os"
+	"sync"
+)
+
+// ErrNotMultipart is returned by ParseMultipartForm for requests whose
+// Content-Type is not multipart/form-data
+var ErrNotMultipart = errors.New("request Content-Type isn't multipart/form-data")
+
+// Bound on a urlencoded form body, which is always read into memory
+const maxFormBytes = 10 * 1024 * 1024
+
+// MultipartLimits bounds how much of a multipart/form-data body
+// ParseMultipartForm accepts
+type MultipartLimits struct {
+	// MaxMemory is how many bytes of parts are held in memory in total.
+	// Field values always count against it and fail the form with
+	// ErrBodyTooLarge once it runs out. Files that don't fit in what is
+	// left are spooled to temporary files.
+	MaxMemory int
+	// MaxPartBytes bounds each part, field or file. Zero means no limit.
+	MaxPartBytes int
+	// MaxTotalBytes bounds the whole body. Zero means no limit.
+	MaxTotalBytes int
+}
+
+// DefaultMultipartLimits are sensible limits for ParseMultipartForm
+var DefaultMultipartLimits = MultipartLimits{
+	MaxMemory:     32 * 1024 * 1024,
+	MaxPartBytes:  64 * 1024 * 1024,
+	MaxTotalBytes: 256 * 1024 * 1024,
+}
+
+// MultipartForm holds a parsed multipart/form-data body
+type MultipartForm struct {
+	// Value holds the parts without a file name
+	Value Values
+	// File holds the parts with a file name
+	File map[string][]*FileHeader
+}
+
+// RemoveAll removes the temporary files of spooled file parts
+func (f *MultipartForm) RemoveAll() error {
+	var errs []error
+	for _, fhs := range f.File {
+		for _, fh := range fhs {
+			if fh.tmpfile == "" {
+				continue
+			}
+			if err := os.Remove(fh.tmpfile); err != nil && !errors.Is(err, os.ErrNotExist) {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// FileHeader describes a file part of a multipart form
+type FileHeader struct {
+	Filename string
+	Header   *headers.Headers
+	Size     int64
+
+	content []byte
+	tmpfile string
+}
+
+// File is the content of a file part, either in memory or spooled to disk
+type File interface {
+	io.Reader
+	io.ReaderAt
+	io.Seeker
+	io.Closer
+}
+
+// Open returns the content of the file part
+func (fh *FileHeader) Open() (File, error) {
+	if fh.tmpfile != "" {
+		return os.Open(fh.tmpfile)
+	}
+	return memoryFile{bytes.NewReader(fh.content)}, nil
+}
+
+type memoryFile struct {
+	*bytes.Reader
+}
+
+func (memoryFile) Close() error {
+	return nil
+}
+
+// ParseForm fills Form with the query parameters and, for an
+// application/x-www-form-urlencoded body, PostForm with the body
+// parameters. Form holds the body parameters before the query ones. It
+// reads the body from BodyReader and does nothing when called again.
+func (req *Request) ParseForm() error {
+	if req.Form != nil {
+		return nil
+	}
+
+	req.PostForm = make(Values)
+	if mediaType(req) == "application/x-www-form-urlencoded" {
+		body, err := io.ReadAll(io.LimitReader(req.BodyReader, maxFormBytes+1))
+		if err != nil {
+			return err
+		}
+		if len(body) > maxFormBytes {
+			return fmt.Errorf("%w: form exceeds %d bytes", ErrBodyTooLarge, maxFormBytes)
+		}
+
+		postForm, err := ParseQuery(string(body))
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrMalformedBody, err)
+		}
+		req.PostForm = postForm
+	}
+
+	query, err := ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		return err
+	}
+
+	req.Form = make(Values)
+	for _, vs := range []Values{req.PostForm, query} {
+		for key, values := range vs {
+			req.Form[key] = append(req.Form[key], values...)
+		}
+	}
+
+	return nil
+}
+
+// ParseMultipartForm parses a multipart/form-data body into
+// MultipartForm, using the boundary from the Content-Type header. Fields
+// are also added to Form and PostForm, and the query to Form. Files that
+// don't fit in limits.MaxMemory are spooled to temporary files, which the
+// server removes once the handler returns, even when the form was parsed
+// on a copy made by WithContext. It does nothing when called again.
+func (req *Request) ParseMultipartForm(limits MultipartLimits) error {
+	if req.MultipartForm != nil {
+		return nil
+	}
+
+	if mediaType(req) != "multipart/form-data" {
+		return ErrNotMultipart
+	}
+
+	_, params, err := mime.ParseMediaType(req.Headers.Get("content-type"))
+	if err != nil || params["boundary"] == "" {
+		return fmt.Errorf("%w: multipart/form-data without a boundary", ErrMalformedRequest)
+	}
+
+	if err := req.ParseForm(); err != nil {
+		return err
+	}
+
+	body := &limitedReader{r: req.BodyReader, remaining: limits.MaxTotalBytes, limited: limits.MaxTotalBytes > 0}
+	form, err := readMultipartForm(multipart.NewReader(body, params["boundary"]), limits)
+	if err != nil {
+		if body.exceeded {
+			err = fmt.Errorf("%w: form exceeds %d bytes", ErrBodyTooLarge, limits.MaxTotalBytes)
+		}
+		return err
+	}
+
+	for key, values := range form.Value {
+		req.Form[key] = append(req.Form[key], values...)
+		req.PostForm[key] = append(req.PostForm[key], values...)
+	}
+	req.MultipartForm = form
+	if req.forms == nil {
+		req.forms = &multipartForms{}
+	}
+	req.forms.add(form)
+
+	return nil
+}
+
+// RemoveMultipartFiles removes the temporary files of every multipart form
+// parsed on req or on a copy of it made by WithContext
+func (req *Request) RemoveMultipartFiles() error {
+	if req.forms == nil {
+		return nil
+	}
+	return req.forms.removeAll()
+}
+
+// The multipart forms parsed on any copy of a request, so their files can
+// be removed whichever copy the handler parsed them on
+type multipartForms struct {
+	mu    sync.Mutex
+	forms []*MultipartForm
+}
+
+func (m *multipartForms) add(form *MultipartForm) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.forms = append(m.forms, form)
+}
+
+func (m *multipartForms) removeAll() error {
+	m.mu.Lock()
+	forms := m.forms
+	m.forms = nil
+	m.mu.Unlock()
+
+	var errs []error
+	for _, form := range forms {
+		errs = append(errs, form.RemoveAll())
+	}
+	return errors.Join(errs...)
+}
+
+func readMultipartForm(mr *multipart.Reader, limits MultipartLimits) (_ *MultipartForm, err error) {
+	form := &MultipartForm{Value: make(Values), File: make(map[string][]*FileHeader)}
+	defer func() {
+		if err != nil {
+			form.RemoveAll()
+		}
+	}()
+
+	memory := limits.MaxMemory
+	for {
+		part, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			return form, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrMalformedBody, err)
+		}
+
+		name := part.FormName()
+		if name == "" {
+			part.Close()
+			continue
+		}
+
+		content := io.Reader(part)
+		if limits.MaxPartBytes > 0 {
+			content = &limitedReader{r: part, remaining: limits.MaxPartBytes, limited: true}
+		}
+
+		if part.FileName() == "" {
+			value, err := io.ReadAll(io.LimitReader(content, int64(max(memory, 0))+1))
+			if err != nil {
+				return nil, partError(name, err, limits)
+			}
+			if len(value) > memory {
+				return nil, fmt.Errorf("%w: form fields exceed %d bytes of memory", ErrBodyTooLarge, limits.MaxMemory)
+			}
+			memory -= len(value)
+			form.Value.Add(name, string(value))
+			continue
+		}
+
+		fh := &FileHeader{Filename: part.FileName(), Header: headers.NewHeaders()}
+		for key, values := range part.Header {
+			for _, value := range values {
+				fh.Header.Add(key, value)
+			}
+		}
+		form.File[name] = append(form.File[name], fh)
+
+		if err := fh.spool(content, &memory); err != nil {
+			return nil, partError(name, err, limits)
+		}
+	}
+}
+
+// Reads the file content into memory while it fits in the remaining
+// memory budget, moving it to a temporary file otherwise
+func (fh *FileHeader) spool(content io.Reader, memory *int) error {
+	var buf bytes.Buffer
+	n, err := io.Copy(&buf, io.LimitReader(content, int64(max(*memory, 0))+1))
+	if err != nil {
+		return err
+	}
+
+	if n <= int64(*memory) {
+		fh.content = buf.Bytes()
+		fh.Size = n
+		*memory -= int(n)
+		return nil
+	}
+
+	file, err := os.CreateTemp("", "multipart-")
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	fh.tmpfile = file.Name()
+
+	size, err := io.Copy(file, io.MultiReader(&buf, content))
+	if err != nil {
+		return err
+	}
+	fh.Size = size
+
+	return file.Close()
+}
+
+// Wraps an error reading a part, reporting parts over the size limit as ErrBodyTooLarge
+func partError(name string, err error, limits MultipartLimits) error {
+	if errors.Is(err, errLimitExceeded) {
+		return fmt.Errorf("%w: part %q exceeds %d bytes", ErrBodyTooLarge, name, limits.MaxPartBytes)
+	}
+	return fmt.Errorf("%w: part %q: %w", ErrMalformedBody, name, err)
+}
+
+// Returns the media type of the body without parameters, or an empty string
+func mediaType(req *Request) string {
+	mt, _, err := mime.ParseMediaType(req.Headers.Get("content-type"))
+	if err != nil {
+		return ""
+	}
+	return mt
+}
+
+var errLimitExceeded = errors.New("read limit exceeded")
+
+// limitedReader fails reads past its limit instead of ending the data early,
+// so content cut short can't pass as complete
+type limitedReader struct {
+	r         io.Reader
+	remaining int
+	limited   bool
+	exceeded  bool
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if !l.limited {
+		return l.r.Read(p)
+	}
+
+	if l.remaining < 0 {
+		l.exceeded = true
+		return 0, errLimitExceeded
+	}
+
+	// Reading one byte past the limit tells a body that is exactly at the limit from a longer one
+	if len(p) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= n
+	if l.remaining < 0 {
+		l.exceeded = true
+		return 0, errLimitExceeded
+	}
+	return n, err
+}
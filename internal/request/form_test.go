@@ -0,0 +1,159 @@
+package request
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// formRequest parses a POST request to target with the given content type and body
+func formRequest(t *testing.T, target, contentType, body string) *Request {
+	t.Helper()
+
+	raw := "POST " + target + " HTTP/1.1\r\nHost: localhost\r\n" +
+		"Content-Type: " + contentType + "\r\n" +
+		"Content-Length: " + strconv.Itoa(len(body)) + "\r\n\r\n" + body
+	r, err := RequestFromReader(strings.NewReader(raw))
+	require.NoError(t, err)
+	return r
+}
+
+// multipartBody builds a multipart/form-data body with the given fields and files
+func multipartBody(t *testing.T, fields map[string]string, files map[string]string) (string, string) {
+	t.Helper()
+
+	buf := &bytes.Buffer{}
+	mw := multipart.NewWriter(buf)
+	for name, value := range fields {
+		require.NoError(t, mw.WriteField(name, value))
+	}
+	for name, content := range files {
+		fw, err := mw.CreateFormFile(name, name+".txt")
+		require.NoError(t, err)
+		_, err = fw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, mw.Close())
+
+	return mw.FormDataContentType(), buf.String()
+}
+
+// Urlencoded Form Tests
+func TestRequest_ParseForm(t *testing.T) {
+	r := formRequest(t, "/submit?a=query&q=1", "application/x-www-form-urlencoded; charset=utf-8", "a=body&name=J%C3%BCrgen+S&empty=")
+
+	require.NoError(t, r.ParseForm())
+	assert.Equal(t, []string{"body", "query"}, r.Form["a"])
+	assert.Equal(t, "1", r.Form.Get("q"))
+	assert.Equal(t, "Jürgen S", r.Form.Get("name"))
+	assert.True(t, r.PostForm.Has("empty"))
+	assert.False(t, r.PostForm.Has("q"))
+
+	// Parsing again keeps the first result
+	require.NoError(t, r.ParseForm())
+	assert.Equal(t, []string{"body", "query"}, r.Form["a"])
+}
+
+func TestRequest_ParseFormOtherContentType(t *testing.T) {
+	r := formRequest(t, "/submit?q=1", "application/json", `{"a":"b"}`)
+
+	require.NoError(t, r.ParseForm())
+	assert.Equal(t, Values{"q": {"1"}}, r.Form)
+	assert.Empty(t, r.PostForm)
+
+	body, err := io.ReadAll(r.BodyReader)
+	require.NoError(t, err)
+	assert.Equal(t, `{"a":"b"}`, string(body))
+}
+
+func TestRequest_ParseFormMalformed(t *testing.T) {
+	r := formRequest(t, "/submit", "application/x-www-form-urlencoded", "a=%zz")
+	require.ErrorIs(t, r.ParseForm(), ErrMalformedBody)
+}
+
+// Multipart Form Tests
+func TestRequest_ParseMultipartForm(t *testing.T) {
+	contentType, body := multipartBody(t,
+		map[string]string{"title": "report"},
+		map[string]string{"small": "tiny", "large": strings.Repeat("x", 100)})
+	r := formRequest(t, "/upload?q=1", contentType, body)
+
+	require.NoError(t, r.ParseMultipartForm(MultipartLimits{MaxMemory: 50}))
+	defer r.MultipartForm.RemoveAll()
+
+	assert.Equal(t, "report", r.Form.Get("title"))
+	assert.Equal(t, "report", r.PostForm.Get("title"))
+	assert.Equal(t, "1", r.Form.Get("q"))
+
+	small := r.MultipartForm.File["small"][0]
+	assert.Equal(t, "small.txt", small.Filename)
+	assert.Equal(t, int64(4), small.Size)
+	assert.Equal(t, "application/octet-stream", small.Header.Get("content-type"))
+	assert.Empty(t, small.tmpfile)
+
+	large := r.MultipartForm.File["large"][0]
+	assert.Equal(t, int64(100), large.Size)
+	require.NotEmpty(t, large.tmpfile)
+
+	for fh, expected := range map[*FileHeader]string{small: "tiny", large: strings.Repeat("x", 100)} {
+		f, err := fh.Open()
+		require.NoError(t, err)
+		content, err := io.ReadAll(f)
+		require.NoError(t, err)
+		assert.Equal(t, expected, string(content))
+		require.NoError(t, f.Close())
+	}
+
+	require.NoError(t, r.MultipartForm.RemoveAll())
+	_, err := os.Stat(large.tmpfile)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestRequest_ParseMultipartFormLimits(t *testing.T) {
+	contentType, body := multipartBody(t,
+		map[string]string{"note": strings.Repeat("n", 20)},
+		map[string]string{"file": strings.Repeat("f", 20)})
+
+	testCases := []struct {
+		name   string
+		limits MultipartLimits
+		err    error
+	}{
+		{name: "within limits", limits: MultipartLimits{MaxMemory: 20, MaxPartBytes: 20, MaxTotalBytes: len(body)}},
+		{name: "part too large", limits: MultipartLimits{MaxMemory: 1024, MaxPartBytes: 19}, err: ErrBodyTooLarge},
+		{name: "body too large", limits: MultipartLimits{MaxMemory: 1024, MaxTotalBytes: len(body) - 1}, err: ErrBodyTooLarge},
+		{name: "fields exceed memory", limits: MultipartLimits{MaxMemory: 19}, err: ErrBodyTooLarge},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := formRequest(t, "/upload", contentType, body)
+			err := r.ParseMultipartForm(tc.limits)
+			if tc.err == nil {
+				require.NoError(t, err)
+				r.MultipartForm.RemoveAll()
+				return
+			}
+			require.ErrorIs(t, err, tc.err)
+			assert.Nil(t, r.MultipartForm)
+		})
+	}
+}
+
+func TestRequest_ParseMultipartFormErrors(t *testing.T) {
+	r := formRequest(t, "/upload", "application/x-www-form-urlencoded", "a=1")
+	require.ErrorIs(t, r.ParseMultipartForm(DefaultMultipartLimits), ErrNotMultipart)
+
+	r = formRequest(t, "/upload", "multipart/form-data", "")
+	require.ErrorIs(t, r.ParseMultipartForm(DefaultMultipartLimits), ErrMalformedRequest)
+
+	r = formRequest(t, "/upload", "multipart/form-data; boundary=xyz", "--xyz\r\nContent-Disposition: form-data; name=\"a\"\r\n\r\nunterminated")
+	require.ErrorIs(t, r.ParseMultipartForm(DefaultMultipartLimits), ErrMalformedBody)
+}
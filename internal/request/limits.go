@@ -0,0 +1,89 @@
+package request
+
+import (
+	"bytes"
+	"fmt"
+	"http-server/internal/headers"
+)
+
+// Limits bounds how much of a request RequestFromReader accepts. A zero
+// field means no limit.
+type Limits struct {
+	// MaxRequestLineBytes bounds the request line, excluding its CRLF
+	MaxRequestLineBytes int
+	// MaxHeaderBytes bounds the header section, including trailers of a chunked body
+	MaxHeaderBytes int
+	// MaxHeaderCount bounds the number of header and trailer field lines
+	MaxHeaderCount int
+	// MaxBodyBytes bounds the body after any chunked framing is removed
+	MaxBodyBytes int
+}
+
+// DefaultLimits are applied by RequestFromReader unless WithLimits is given
+var DefaultLimits = Limits{
+	MaxRequestLineBytes: 8 * 1024,
+	MaxHeaderBytes:      64 * 1024,
+	MaxHeaderCount:      100,
+	MaxBodyBytes:        10 * 1024 * 1024,
+}
+
+// Option configures how RequestFromReader parses a request
+type Option func(*Request)
+
+// WithLimits replaces DefaultLimits for a single call to RequestFromReader
+func WithLimits(limits Limits) Option {
+	return func(req *Request) {
+		req.limits = limits
+	}
+}
+
+// Returns the length of the line at the start of data, or of all of data
+// when the line is not complete yet
+func pendingLineLength(data []byte) int {
+	idx := bytes.Index(data, []byte(crlf))
+	if idx == -1 {
+		return len(data)
+	}
+	return idx
+}
+
+func (req *Request) checkRequestLine(data []byte) error {
+	maxBytes := req.limits.MaxRequestLineBytes
+	if maxBytes > 0 && pendingLineLength(data) > maxBytes {
+		return fmt.Errorf("%w: request line exceeds %d bytes", ErrURITooLong, maxBytes)
+	}
+	return nil
+}
+
+// Parses one header or trailer field line into h, counting it against the header limits
+func (req *Request) parseFieldLine(h *headers.Headers, data []byte) (int, bool, error) {
+	maxBytes := req.limits.MaxHeaderBytes
+	if maxBytes > 0 && req.headerBytes+pendingLineLength(data) > maxBytes {
+		return 0, false, fmt.Errorf("%w: header section exceeds %d bytes", headers.ErrHeaderTooLarge, maxBytes)
+	}
+
+	n, done, err := h.Parse(data)
+	if err != nil {
+		return 0, false, err
+	}
+
+	req.headerBytes += n
+	if n > 0 && !done {
+		req.headerCount++
+	}
+
+	maxCount := req.limits.MaxHeaderCount
+	if maxCount > 0 && req.headerCount > maxCount {
+		return 0, false, fmt.Errorf("%w: more than %d header fields", headers.ErrHeaderTooLarge, maxCount)
+	}
+
+	return n, done, nil
+}
+
+func (req *Request) checkBodyLength(length int) error {
+	maxBytes := req.limits.MaxBodyBytes
+	if maxBytes > 0 && length > maxBytes {
+		return fmt.Errorf("%w: body exceeds %d bytes", ErrBodyTooLarge, maxBytes)
+	}
+	return nil
+}
@@ -1,20 +1,54 @@
 package request
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"http-server/internal/headers"
 	"io"
-	"strconv"
 	"strings"
 )
 
 type Request struct {
 	RequestLine RequestLine
-	Headers     headers.Headers
-	Body        []byte
-	state       State
+	// URL is the parsed RequestLine.RequestTarget
+	URL     URL
+	Headers *headers.Headers
+	// Body holds the whole body, unless it is streamed with WithStreamingBody
+	Body []byte
+	// BodyReader reads the body. When streaming it enforces the body framing
+	// as it reads, and Close discards the unread rest of the body.
+	BodyReader io.ReadCloser
+	// Trailers holds the trailer fields sent after a chunked body. When
+	// streaming they are only available once BodyReader reached io.EOF.
+	Trailers *headers.Headers
+	// Form holds the query and form body parameters once ParseForm or
+	// ParseMultipartForm was called
+	Form Values
+	// PostForm holds only the form body parameters
+	PostForm Values
+	// MultipartForm holds the fields and files of a multipart/form-data
+	// body once ParseMultipartForm was called
+	MultipartForm *MultipartForm
+	state         State
+	bodyLength    int
+	bodyRead      int
+	chunkSize     int
+	limits        Limits
+	headerBytes   int
+	headerCount   int
+	reader        *bufio.Reader
+	streaming     bool
+	// Decoded body bytes waiting to be read from BodyReader when streaming
+	pending []byte
+	// Start of a line longer than the reader's buffer, already taken out of it
+	partial    []byte
+	ctx        context.Context
+	pathValues map[string]string
+	// Shared with every copy made by WithContext
+	forms *multipartForms
 }
 
 type RequestLine struct {
@@ -30,67 +64,141 @@ const (
 	requestStateDone
 	requestStateParsingHeaders
 	requestStateParsingBody
+	requestStateParsingChunkSize
+	requestStateParsingChunkData
+	requestStateParsingChunkDataEnd
+	requestStateParsingTrailers
 )
 
 const crlf = "\r\n"
 
-const bufferSize = 8
-
-func RequestFromReader(reader io.Reader) (*Request, error) {
-	buf := make([]byte, bufferSize)
+// Errors returned by RequestFromReader for requests that cannot be parsed.
+// Errors from the underlying reader are returned as-is.
+var (
+	// ErrMalformedRequestLine is returned for request lines that are not "method target version"
+	ErrMalformedRequestLine = errors.New("malformed request line")
+	// ErrUnsupportedVersion is returned for well-formed HTTP versions other than 1.0 and 1.1
+	ErrUnsupportedVersion = errors.New("unsupported HTTP version")
+	// ErrMalformedRequest is returned for headers that make the request invalid as a whole
+	ErrMalformedRequest = errors.New("malformed request")
+	// ErrMalformedBody is returned for invalid chunked framing
+	ErrMalformedBody = errors.New("malformed request body")
+	// ErrBodyTooShort is returned when the connection closes before the body is complete
+	ErrBodyTooShort = errors.New("request body incomplete")
+	// ErrBodyTooLarge is returned when the body is larger than the parser accepts
+	ErrBodyTooLarge = errors.New("request body too large")
+	// ErrNotImplemented is returned for transfer codings the parser cannot decode
+	ErrNotImplemented = errors.New("not implemented")
+	// ErrURITooLong is returned when the request line is longer than the parser accepts
+	ErrURITooLong = errors.New("request line too long")
+)
 
-	readToIndex := 0
+// Buffer size used when the reader passed to RequestFromReader is not already buffered
+const bufferSize = 4096
+
+// RequestFromReader parses a single request from reader. When reader is a
+// *bufio.Reader it is read from directly, so any bytes after the request
+// (e.g. a pipelined request) stay buffered for the next call. Sizes are
+// bounded by DefaultLimits unless WithLimits is given, whatever the size
+// of the reader's buffer. With
+// WithStreamingBody it returns as soon as the headers are parsed and the
+// body is decoded while it is read from BodyReader.
+func RequestFromReader(reader io.Reader, opts ...Option) (*Request, error) {
+	buf, ok := reader.(*bufio.Reader)
+	if !ok {
+		buf = bufio.NewReaderSize(reader, bufferSize)
+	}
 
 	req := Request{}
 	req.Headers = headers.NewHeaders()
+	req.Trailers = headers.NewHeaders()
 	req.state = requestStateInitialized
+	req.limits = DefaultLimits
+	req.reader = buf
+	req.forms = &multipartForms{}
+	for _, opt := range opts {
+		opt(&req)
+	}
 
 	for req.state != requestStateDone {
-
-		if readToIndex >= len(buf) {
-			new_buf := make([]byte, len(buf)*2)
-			copy(new_buf, buf[:readToIndex])
-			buf = new_buf
+		if req.streaming && req.state >= requestStateParsingBody {
+			break
 		}
 
-		readBytes, err := reader.Read(buf[readToIndex:])
-		if err != nil {
-			if errors.Is(err, io.EOF) {
-				if req.state == requestStateParsingBody {
-					contentValue, exists := req.Headers["content-length"]
-					if exists {
-						contentLength, _ := strconv.Atoi(contentValue)
-						if len(req.Body) < contentLength {
-							return nil, fmt.Errorf("invalid request: body length is less than defined Content-Length header")
-						}
-					}
-				}
-				req.state = requestStateDone
-				break
-			}
-			return &req, err
+		if err := req.advance(); err != nil {
+			return nil, err
 		}
+	}
 
-		readToIndex += readBytes
+	if req.streaming {
+		req.BodyReader = &bodyReader{req: &req}
+	} else {
+		req.BodyReader = io.NopCloser(bytes.NewReader(req.Body))
+	}
 
-		totalBytesParsed, err := req.parse(buf[:readToIndex])
-		if err != nil {
-			req.state = requestStateDone
-			return &req, err
-		}
+	return &req, nil
+}
 
-		if totalBytesParsed > 0 {
-			copy(buf, buf[totalBytesParsed:])
-			readToIndex -= totalBytesParsed
-		}
+// Parses everything already buffered, reading more from the connection
+// only when no progress can be made without it
+func (req *Request) advance() error {
+	buf := req.reader
 
+	peeked, _ := buf.Peek(buf.Buffered())
+	data := peeked
+	if len(req.partial) > 0 {
+		data = append(req.partial[:len(req.partial):len(req.partial)], peeked...)
 	}
 
-	if req.state != requestStateDone {
-		return nil, fmt.Errorf("incomplete request: no valid request line found")
+	totalBytesParsed, err := req.parse(data)
+	if err != nil {
+		req.state = requestStateDone
+		return err
 	}
 
-	return &req, nil
+	if totalBytesParsed > 0 {
+		// The partial line holds no complete line, so parsing always ends in the buffered bytes
+		buf.Discard(totalBytesParsed - len(req.partial))
+		req.partial = nil
+		return nil
+	}
+
+	if req.state == requestStateDone {
+		return nil
+	}
+
+	if buf.Buffered() >= buf.Size() {
+		switch req.state {
+		case requestStateInitialized, requestStateParsingHeaders, requestStateParsingTrailers:
+			// These lines are bounded by Limits rather than the buffer, so
+			// their start moves out of the buffer to make room for the rest
+			req.partial = append(req.partial, peeked...)
+			buf.Discard(len(peeked))
+			return nil
+		default:
+			return fmt.Errorf("%w: chunk size line exceeds %d bytes", ErrMalformedBody, buf.Size())
+		}
+	}
+
+	_, err = buf.Peek(buf.Buffered() + 1)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			if req.state == requestStateInitialized && buf.Buffered() == 0 && len(req.partial) == 0 {
+				req.state = requestStateDone
+				return nil
+			}
+			if req.state == requestStateParsingBody {
+				return fmt.Errorf("%w: body length is less than defined Content-Length header", ErrBodyTooShort)
+			}
+			if req.state > requestStateParsingBody {
+				return fmt.Errorf("%w: connection closed before the last chunk", ErrBodyTooShort)
+			}
+			return fmt.Errorf("%w: connection closed before the request was complete", ErrMalformedRequest)
+		}
+		return err
+	}
+
+	return nil
 }
 
 func (req *Request) parse(data []byte) (int, error) {
@@ -98,6 +206,10 @@ func (req *Request) parse(data []byte) (int, error) {
 	switch req.state {
 
 	case requestStateInitialized:
+		if err := req.checkRequestLine(data); err != nil {
+			return 0, err
+		}
+
 		requestLine, bytesRead, err := parseRequestLine(data)
 		if err != nil {
 			return 0, err
@@ -107,7 +219,13 @@ func (req *Request) parse(data []byte) (int, error) {
 			return 0, nil
 		}
 
+		url, err := parseTarget(requestLine.Method, requestLine.RequestTarget)
+		if err != nil {
+			return 0, err
+		}
+
 		req.RequestLine = *requestLine
+		req.URL = url
 		req.state = requestStateParsingHeaders
 
 		return bytesRead, nil
@@ -117,48 +235,94 @@ func (req *Request) parse(data []byte) (int, error) {
 
 	case requestStateParsingHeaders:
 
-		h := req.Headers
-
-		totalBytesParsed, done, err := h.Parse(data)
+		totalBytesParsed, done, err := req.parseFieldLine(req.Headers, data)
 
 		if err != nil {
 			return 0, err
 		}
 
 		if done {
-			req.state = requestStateParsingBody
+			// HTTP/1.0 predates Host, HTTP/1.1 requires exactly one (RFC 9112 section 3.2)
+			if req.RequestLine.HttpVersion == "1.1" {
+				if hosts := req.Headers.Values("host"); len(hosts) != 1 || strings.Contains(hosts[0], ",") {
+					return 0, fmt.Errorf("%w: HTTP/1.1 requires a single Host header", ErrMalformedRequest)
+				}
+			}
+
+			state, err := req.bodyState()
+			if err != nil {
+				return 0, err
+			}
+			req.state = state
 		}
 
 		return totalBytesParsed, nil
 
 	case requestStateParsingBody:
-		contentValue, exists := req.Headers["content-length"]
+		// Anything past Content-Length belongs to the next request on the connection
+		n := min(len(data), req.bodyLength-req.bodyRead)
+		req.appendBody(data[:n])
 
-		if !exists {
-			if len(data) > 0 {
-				return 0, fmt.Errorf("invalid request: Content-Length header missing for non-empty body")
-			}
+		if req.bodyRead == req.bodyLength {
 			req.state = requestStateDone
-			return 0, nil
 		}
 
-		req.Body = append(req.Body, data...)
+		return n, nil
 
-		contentLength, err := strconv.Atoi(contentValue)
+	case requestStateParsingChunkSize:
+		size, bytesRead, err := parseChunkSize(data)
+		if err != nil || bytesRead == 0 {
+			return 0, err
+		}
 
-		if err != nil {
+		if err := req.checkBodyLength(req.bodyRead + size); err != nil {
 			return 0, err
 		}
 
-		if len(req.Body) > contentLength {
-			return 0, fmt.Errorf("invalid request: body length exceeds Content-Length header")
+		req.chunkSize = size
+		req.state = requestStateParsingChunkData
+		if size == 0 {
+			req.state = requestStateParsingTrailers
+		}
+
+		return bytesRead, nil
+
+	case requestStateParsingChunkData:
+		n := min(len(data), req.chunkSize)
+		req.appendBody(data[:n])
+		req.chunkSize -= n
+
+		if req.chunkSize == 0 {
+			req.state = requestStateParsingChunkDataEnd
+		}
+
+		return n, nil
+
+	case requestStateParsingChunkDataEnd:
+		if len(data) < len(crlf) {
+			return 0, nil
+		}
+
+		if !bytes.HasPrefix(data, []byte(crlf)) {
+			return 0, fmt.Errorf("%w: chunk data not followed by CRLF", ErrMalformedBody)
+		}
+
+		req.state = requestStateParsingChunkSize
+
+		return len(crlf), nil
+
+	case requestStateParsingTrailers:
+		totalBytesParsed, done, err := req.parseFieldLine(req.Trailers, data)
+
+		if err != nil {
+			return 0, fmt.Errorf("%w: invalid trailer: %w", ErrMalformedBody, err)
 		}
 
-		if len(req.Body) == contentLength {
+		if done {
 			req.state = requestStateDone
 		}
 
-		return len(data), nil
+		return totalBytesParsed, nil
 
 	default:
 
@@ -188,36 +352,40 @@ func parseRequestLine(content []byte) (*RequestLine, int, error) {
 
 func requestLineExtractor(line string) (*RequestLine, error) {
 	if len(line) == 0 {
-		return nil, fmt.Errorf("invalid request format: no request line found")
+		return nil, fmt.Errorf("%w: no request line found", ErrMalformedRequestLine)
 	}
 
 	requestLine := line
 	parts := strings.Split(requestLine, " ")
 
 	if len(parts) != 3 {
-		return nil, fmt.Errorf("invalid request line: expected 3 parts, got %d", len(parts))
+		return nil, fmt.Errorf("%w: expected 3 parts, got %d", ErrMalformedRequestLine, len(parts))
 	}
 
 	httpMethod := parts[0]
 	if httpMethod != strings.ToUpper(httpMethod) {
-		return nil, fmt.Errorf("invalid HTTP method: must be uppercase")
+		return nil, fmt.Errorf("%w: HTTP method must be uppercase", ErrMalformedRequestLine)
 	}
 
 	requestTarget := parts[1]
 
 	versionParts := strings.Split(parts[2], "/")
 	if len(versionParts) != 2 {
-		return nil, fmt.Errorf("invalid HTTP version: missing version parts %s", parts[2])
+		return nil, fmt.Errorf("%w: missing version parts %s", ErrMalformedRequestLine, parts[2])
 	}
 
 	httpPart := versionParts[0]
 	if httpPart != "HTTP" {
-		return nil, fmt.Errorf("invalid HTTP version: unrecognized HTTP-version %s", httpPart)
+		return nil, fmt.Errorf("%w: unrecognized HTTP-version %s", ErrMalformedRequestLine, httpPart)
 	}
 
 	httpVersion := versionParts[1]
-	if httpVersion != "1.1" {
-		return nil, fmt.Errorf("invalid HTTP version: unrecognized HTTP-version %s", httpVersion)
+	if len(httpVersion) != 3 || !isDigit(httpVersion[0]) || httpVersion[1] != '.' || !isDigit(httpVersion[2]) {
+		return nil, fmt.Errorf("%w: unrecognized HTTP-version %s", ErrMalformedRequestLine, httpVersion)
+	}
+
+	if httpVersion != "1.1" && httpVersion != "1.0" {
+		return nil, fmt.Errorf("%w: HTTP/%s", ErrUnsupportedVersion, httpVersion)
 	}
 
 	return &RequestLine{
@@ -226,3 +394,52 @@ func requestLineExtractor(line string) (*RequestLine, error) {
 		HttpVersion:   httpVersion,
 	}, nil
 }
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// KeepAlive reports whether the client allows the connection to be reused
+// after this request. HTTP/1.0 connections are only persistent when the
+// client asks for it with Connection: keep-alive.
+func (req *Request) KeepAlive() bool {
+	if req.RequestLine.HttpVersion == "1.0" {
+		return req.Headers.HasToken("connection", "keep-alive")
+	}
+	return !req.Headers.HasToken("connection", "close")
+}
+
+// Context returns the request's context. The server cancels it when the
+// client disconnects, the server is closed or the handler runs out of time.
+func (req *Request) Context() context.Context {
+	if req.ctx != nil {
+		return req.ctx
+	}
+	return context.Background()
+}
+
+// WithContext returns a shallow copy of req with its context replaced by
+// ctx, e.g. to pass request-scoped values on to the next handler
+func (req *Request) WithContext(ctx context.Context) *Request {
+	if ctx == nil {
+		panic("nil context")
+	}
+
+	r := *req
+	r.ctx = ctx
+	return &r
+}
+
+// PathValue returns the path parameter captured under name by a router,
+// or an empty string if there is none
+func (req *Request) PathValue(name string) string {
+	return req.pathValues[name]
+}
+
+// SetPathValue records a captured path parameter for PathValue
+func (req *Request) SetPathValue(name, value string) {
+	if req.pathValues == nil {
+		req.pathValues = make(map[string]string)
+	}
+	req.pathValues[name] = value
+}
@@ -1,7 +1,11 @@
 package request
 
 import (
+	"bufio"
+	"context"
+	"http-server/internal/headers"
 	"io"
+	"strconv"
 	"strings"
 	"testing"
 
@@ -31,6 +35,23 @@ func (cr *chunkReader) Read(p []byte) (n int, err error) {
 	return n, nil
 }
 
+// blockingReader delivers its data in a single read and fails the test on any
+// further read, the way a client connection would block waiting for the next request
+type blockingReader struct {
+	data string
+	done bool
+}
+
+func (br *blockingReader) Read(p []byte) (n int, err error) {
+	if br.done {
+		panic("read past the end of the request")
+	}
+	n = copy(p, br.data)
+	br.data = br.data[n:]
+	br.done = len(br.data) == 0
+	return n, nil
+}
+
 // Request Line Tests
 func TestRequestFromReader_ValidGETRequestRoot(t *testing.T) {
 	r, err := RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\nHost: localhost:42069\r\nUser-Agent: curl/7.81.0\r\nAccept: */*\r\n\r\n"))
@@ -56,7 +77,38 @@ func TestRequestFromReader_InvalidRequestLineParts(t *testing.T) {
 }
 
 func TestRequestFromReader_UnsupportedHTTPVersion(t *testing.T) {
-	_, err := RequestFromReader(strings.NewReader("GET / HTTP/1.0\r\nHost: localhost:42069\r\n\r\n"))
+	_, err := RequestFromReader(strings.NewReader("GET / HTTP/2.0\r\nHost: localhost:42069\r\n\r\n"))
+	require.ErrorIs(t, err, ErrUnsupportedVersion)
+}
+
+func TestRequestFromReader_MalformedHTTPVersion(t *testing.T) {
+	_, err := RequestFromReader(strings.NewReader("GET / HTTP/one\r\nHost: localhost:42069\r\n\r\n"))
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, ErrUnsupportedVersion)
+}
+
+func TestRequestFromReader_HTTP10Request(t *testing.T) {
+	r, err := RequestFromReader(strings.NewReader("GET / HTTP/1.0\r\n\r\n"))
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "1.0", r.RequestLine.HttpVersion)
+	assert.False(t, r.KeepAlive())
+}
+
+func TestRequestFromReader_HTTP10KeepAlive(t *testing.T) {
+	r, err := RequestFromReader(strings.NewReader("GET / HTTP/1.0\r\nConnection: keep-alive\r\n\r\n"))
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.True(t, r.KeepAlive())
+}
+
+func TestRequestFromReader_HTTP11MissingHost(t *testing.T) {
+	_, err := RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\nAccept: */*\r\n\r\n"))
+	require.Error(t, err)
+}
+
+func TestRequestFromReader_HTTP11MultipleHosts(t *testing.T) {
+	_, err := RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\nHost: a.example\r\nHost: b.example\r\n\r\n"))
 	require.Error(t, err)
 }
 
@@ -116,9 +168,9 @@ func TestRequestFromReader_StandardHeaders(t *testing.T) {
 	r, err := RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "localhost:42069", r.Headers["host"])
-	assert.Equal(t, "curl/7.81.0", r.Headers["user-agent"])
-	assert.Equal(t, "*/*", r.Headers["accept"])
+	assert.Equal(t, "localhost:42069", r.Headers.Get("host"))
+	assert.Equal(t, "curl/7.81.0", r.Headers.Get("user-agent"))
+	assert.Equal(t, "*/*", r.Headers.Get("accept"))
 }
 
 func TestRequestFromReader_MalformedHeader(t *testing.T) {
@@ -187,13 +239,421 @@ func TestRequestFromReader_BodyShorterThanReportedLength(t *testing.T) {
 }
 
 func TestRequestFromReader_BodyWithoutContentLength(t *testing.T) {
-	reader := &chunkReader{
+	reader := bufio.NewReader(&chunkReader{
 		data: "POST /submit HTTP/1.1\r\n" +
 			"Host: localhost:42069\r\n" +
 			"\r\n" +
 			"Hello World!",
 		numBytesPerRead: 3,
+	})
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Empty(t, r.Body)
+
+	// The unframed bytes are not a body, so they fail as the next request
+	_, err = RequestFromReader(reader)
+	require.Error(t, err)
+}
+
+func TestRequestFromReader_BodyLongerThanReportedLength(t *testing.T) {
+	reader := bufio.NewReader(strings.NewReader("POST /submit HTTP/1.1\r\nHost: localhost:42069\r\nContent-Length: 5\r\n\r\nhello world!"))
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "hello", string(r.Body))
+
+	_, err = RequestFromReader(reader)
+	require.Error(t, err)
+}
+
+// Pipelining Tests
+func TestRequestFromReader_PipelinedRequests(t *testing.T) {
+	reader := bufio.NewReader(&chunkReader{
+		data: "POST /first HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Content-Length: 5\r\n" +
+			"\r\n" +
+			"hello" +
+			"GET /second HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"\r\n" +
+			"GET /third HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Connection: close\r\n" +
+			"\r\n",
+		numBytesPerRead: 7,
+	})
+
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "/first", r.RequestLine.RequestTarget)
+	assert.Equal(t, "hello", string(r.Body))
+	assert.True(t, r.KeepAlive())
+
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "/second", r.RequestLine.RequestTarget)
+	assert.Empty(t, r.Body)
+
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "/third", r.RequestLine.RequestTarget)
+	assert.False(t, r.KeepAlive())
+}
+
+func TestRequestFromReader_LineLongerThanBuffer(t *testing.T) {
+	target := "/" + strings.Repeat("a", 64)
+	cookie := strings.Repeat("c", 64)
+	reader := bufio.NewReaderSize(strings.NewReader("GET "+target+" HTTP/1.1\r\nHost: localhost:42069\r\nCookie: "+cookie+"\r\n\r\n"+
+		"GET /next HTTP/1.1\r\nHost: localhost:42069\r\n\r\n"), 16)
+
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, target, r.RequestLine.RequestTarget)
+	assert.Equal(t, cookie, r.Headers.Get("cookie"))
+
+	// The bytes after the request stay buffered for the next one
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "/next", r.RequestLine.RequestTarget)
+}
+
+func TestRequestFromReader_LongLinesBoundedByLimits(t *testing.T) {
+	limits := Limits{MaxRequestLineBytes: 32, MaxHeaderBytes: 64}
+
+	reader := bufio.NewReaderSize(strings.NewReader("GET /"+strings.Repeat("a", 64)+" HTTP/1.1\r\nHost: localhost:42069\r\n\r\n"), 16)
+	_, err := RequestFromReader(reader, WithLimits(limits))
+	require.ErrorIs(t, err, ErrURITooLong)
+
+	reader = bufio.NewReaderSize(strings.NewReader("GET / HTTP/1.1\r\nHost: localhost:42069\r\nCookie: "+strings.Repeat("c", 64)+"\r\n\r\n"), 16)
+	_, err = RequestFromReader(reader, WithLimits(limits))
+	require.ErrorIs(t, err, headers.ErrHeaderTooLarge)
+}
+
+func TestRequestFromReader_CookieLargerThanDefaultBuffer(t *testing.T) {
+	cookie := strings.Repeat("c", 5*1024)
+	r, err := RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\nHost: localhost:42069\r\nCookie: " + cookie + "\r\n\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, cookie, r.Headers.Get("cookie"))
+}
+
+func TestRequestFromReader_DoesNotReadPastRequest(t *testing.T) {
+	reader := &blockingReader{data: "GET / HTTP/1.1\r\nHost: localhost:42069\r\n\r\n"}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "/", r.RequestLine.RequestTarget)
+}
+
+// Chunked Body Tests
+func TestRequestFromReader_ChunkedBody(t *testing.T) {
+	reader := &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"6\r\nhello \r\n" +
+			"0000006;name=value\r\nworld!\r\n" +
+			"0\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
 	}
-	_, err := RequestFromReader(reader)
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "hello world!", string(r.Body))
+	assert.Zero(t, r.Trailers.Len())
+}
+
+func TestRequestFromReader_ChunkedBodyWithTrailers(t *testing.T) {
+	reader := &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"Trailer: X-Checksum\r\n" +
+			"\r\n" +
+			"A\r\n0123456789\r\n" +
+			"0\r\n" +
+			"X-Checksum: abc123\r\n" +
+			"\r\n",
+		numBytesPerRead: 1,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "0123456789", string(r.Body))
+	assert.Equal(t, "abc123", r.Trailers.Get("X-Checksum"))
+}
+
+func TestRequestFromReader_ChunkedAndContentLength(t *testing.T) {
+	_, err := RequestFromReader(strings.NewReader("POST /submit HTTP/1.1\r\nHost: localhost:42069\r\nContent-Length: 5\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n0\r\n\r\n"))
+	require.Error(t, err)
+}
+
+func TestRequestFromReader_ChunkedInvalidSize(t *testing.T) {
+	_, err := RequestFromReader(strings.NewReader("POST /submit HTTP/1.1\r\nHost: localhost:42069\r\nTransfer-Encoding: chunked\r\n\r\nzz\r\nhello\r\n0\r\n\r\n"))
+	require.Error(t, err)
+}
+
+func TestRequestFromReader_ChunkedMissingDataCRLF(t *testing.T) {
+	_, err := RequestFromReader(strings.NewReader("POST /submit HTTP/1.1\r\nHost: localhost:42069\r\nTransfer-Encoding: chunked\r\n\r\n3\r\nhello\r\n0\r\n\r\n"))
+	require.Error(t, err)
+}
+
+func TestRequestFromReader_ChunkedMissingLastChunk(t *testing.T) {
+	_, err := RequestFromReader(strings.NewReader("POST /submit HTTP/1.1\r\nHost: localhost:42069\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n"))
+	require.Error(t, err)
+}
+
+func TestRequestFromReader_UnsupportedTransferCoding(t *testing.T) {
+	_, err := RequestFromReader(strings.NewReader("POST /submit HTTP/1.1\r\nHost: localhost:42069\r\nTransfer-Encoding: gzip, chunked\r\n\r\n0\r\n\r\n"))
 	require.Error(t, err)
 }
+
+// Error Kind Tests
+func TestRequestFromReader_ErrorKinds(t *testing.T) {
+	testCases := []struct {
+		name     string
+		data     string
+		expected error
+	}{
+		{
+			name:     "missing request line parts",
+			data:     "/coffee HTTP/1.1\r\nHost: localhost:42069\r\n\r\n",
+			expected: ErrMalformedRequestLine,
+		},
+		{
+			name:     "unsupported version",
+			data:     "GET / HTTP/3.0\r\nHost: localhost:42069\r\n\r\n",
+			expected: ErrUnsupportedVersion,
+		},
+		{
+			name:     "invalid header name",
+			data:     "GET / HTTP/1.1\r\nH©st: localhost:42069\r\n\r\n",
+			expected: headers.ErrInvalidHeaderName,
+		},
+		{
+			name:     "malformed header",
+			data:     "GET / HTTP/1.1\r\nHost localhost\r\n\r\n",
+			expected: headers.ErrMalformedHeader,
+		},
+		{
+			name:     "missing host",
+			data:     "GET / HTTP/1.1\r\n\r\n",
+			expected: ErrMalformedRequest,
+		},
+		{
+			name:     "body too short",
+			data:     "POST / HTTP/1.1\r\nHost: localhost:42069\r\nContent-Length: 20\r\n\r\nshort",
+			expected: ErrBodyTooShort,
+		},
+		{
+			name:     "content length overflow",
+			data:     "POST / HTTP/1.1\r\nHost: localhost:42069\r\nContent-Length: 99999999999999999999\r\n\r\n",
+			expected: ErrBodyTooLarge,
+		},
+		{
+			name:     "malformed content length",
+			data:     "POST / HTTP/1.1\r\nHost: localhost:42069\r\nContent-Length: +5\r\n\r\nhello",
+			expected: ErrMalformedRequest,
+		},
+		{
+			name:     "malformed chunk size",
+			data:     "POST / HTTP/1.1\r\nHost: localhost:42069\r\nTransfer-Encoding: chunked\r\n\r\nxyz\r\n",
+			expected: ErrMalformedBody,
+		},
+		{
+			name:     "unsupported transfer coding",
+			data:     "POST / HTTP/1.1\r\nHost: localhost:42069\r\nTransfer-Encoding: gzip\r\n\r\n",
+			expected: ErrNotImplemented,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := RequestFromReader(strings.NewReader(tc.data))
+			require.ErrorIs(t, err, tc.expected)
+		})
+	}
+}
+
+// Limit Tests
+func TestRequestFromReader_Limits(t *testing.T) {
+	limits := Limits{
+		MaxRequestLineBytes: 32,
+		MaxHeaderBytes:      64,
+		MaxHeaderCount:      3,
+		MaxBodyBytes:        8,
+	}
+
+	testCases := []struct {
+		name     string
+		data     string
+		expected error
+	}{
+		{
+			name:     "request line too long",
+			data:     "GET /" + strings.Repeat("a", 40) + " HTTP/1.1\r\nHost: localhost\r\n\r\n",
+			expected: ErrURITooLong,
+		},
+		{
+			name:     "request line too long without CRLF yet",
+			data:     "GET /" + strings.Repeat("a", 40),
+			expected: ErrURITooLong,
+		},
+		{
+			name:     "header section too large",
+			data:     "GET / HTTP/1.1\r\nHost: localhost\r\nX-Long: " + strings.Repeat("a", 60) + "\r\n\r\n",
+			expected: headers.ErrHeaderTooLarge,
+		},
+		{
+			name:     "too many headers",
+			data:     "GET / HTTP/1.1\r\nHost: localhost\r\nA: 1\r\nB: 2\r\nC: 3\r\n\r\n",
+			expected: headers.ErrHeaderTooLarge,
+		},
+		{
+			name:     "content length too large",
+			data:     "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 9\r\n\r\n123456789",
+			expected: ErrBodyTooLarge,
+		},
+		{
+			name:     "chunked body too large",
+			data:     "POST / HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: chunked\r\n\r\n5\r\n12345\r\n5\r\n12345\r\n0\r\n\r\n",
+			expected: ErrBodyTooLarge,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := RequestFromReader(strings.NewReader(tc.data), WithLimits(limits))
+			require.ErrorIs(t, err, tc.expected)
+		})
+	}
+}
+
+func TestRequestFromReader_WithinLimits(t *testing.T) {
+	limits := Limits{
+		MaxRequestLineBytes: 32,
+		MaxHeaderBytes:      64,
+		MaxHeaderCount:      3,
+		MaxBodyBytes:        8,
+	}
+
+	r, err := RequestFromReader(strings.NewReader("POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 8\r\n\r\n12345678"), WithLimits(limits))
+	require.NoError(t, err)
+	assert.Equal(t, "12345678", string(r.Body))
+}
+
+func TestRequestFromReader_DefaultLimitsAreTheRealBound(t *testing.T) {
+	target := "/" + strings.Repeat("a", 5*1024)
+	r, err := RequestFromReader(strings.NewReader("GET " + target + " HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, target, r.RequestLine.RequestTarget)
+
+	target = "/" + strings.Repeat("a", DefaultLimits.MaxRequestLineBytes)
+	_, err = RequestFromReader(strings.NewReader("GET " + target + " HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.ErrorIs(t, err, ErrURITooLong)
+}
+
+func TestRequestFromReader_ZeroLimitsAreUnbounded(t *testing.T) {
+	body := strings.Repeat("a", DefaultLimits.MaxBodyBytes+1)
+	r, err := RequestFromReader(strings.NewReader("POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: "+strconv.Itoa(len(body))+"\r\n\r\n"+body), WithLimits(Limits{}))
+	require.NoError(t, err)
+	assert.Len(t, r.Body, len(body))
+}
+
+// Streaming Body Tests
+func TestRequestFromReader_StreamingBody(t *testing.T) {
+	reader := &blockingReader{data: "POST /upload HTTP/1.1\r\nHost: localhost:42069\r\nContent-Length: 13\r\n\r\n"}
+	r, err := RequestFromReader(reader, WithStreamingBody())
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "/upload", r.RequestLine.RequestTarget)
+	assert.Nil(t, r.Body)
+
+	reader.data, reader.done = "hello world!\n", false
+	body, err := io.ReadAll(r.BodyReader)
+	require.NoError(t, err)
+	assert.Equal(t, "hello world!\n", string(body))
+	assert.Nil(t, r.Body)
+}
+
+func TestRequestFromReader_StreamingChunkedBody(t *testing.T) {
+	reader := &chunkReader{
+		data: "POST /upload HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"6\r\nhello \r\n" +
+			"6\r\nworld!\r\n" +
+			"0\r\n" +
+			"X-Checksum: abc123\r\n" +
+			"\r\n",
+		numBytesPerRead: 4,
+	}
+	r, err := RequestFromReader(reader, WithStreamingBody())
+	require.NoError(t, err)
+	require.NotNil(t, r)
+
+	body, err := io.ReadAll(r.BodyReader)
+	require.NoError(t, err)
+	assert.Equal(t, "hello world!", string(body))
+	assert.Equal(t, "abc123", r.Trailers.Get("X-Checksum"))
+}
+
+func TestRequestFromReader_StreamingBodyTooShort(t *testing.T) {
+	r, err := RequestFromReader(strings.NewReader("POST / HTTP/1.1\r\nHost: localhost:42069\r\nContent-Length: 20\r\n\r\nshort"), WithStreamingBody())
+	require.NoError(t, err)
+
+	_, err = io.ReadAll(r.BodyReader)
+	require.ErrorIs(t, err, ErrBodyTooShort)
+	require.ErrorIs(t, r.BodyReader.Close(), ErrBodyTooShort)
+}
+
+func TestRequestFromReader_StreamingBodyCloseDiscardsRest(t *testing.T) {
+	reader := bufio.NewReader(strings.NewReader(
+		"POST /first HTTP/1.1\r\nHost: localhost:42069\r\nContent-Length: 11\r\n\r\nhello world" +
+			"GET /second HTTP/1.1\r\nHost: localhost:42069\r\n\r\n"))
+
+	r, err := RequestFromReader(reader, WithStreamingBody())
+	require.NoError(t, err)
+
+	part := make([]byte, 5)
+	_, err = io.ReadFull(r.BodyReader, part)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(part))
+	require.NoError(t, r.BodyReader.Close())
+
+	_, err = r.BodyReader.Read(part)
+	require.ErrorIs(t, err, ErrBodyClosed)
+
+	r, err = RequestFromReader(reader, WithStreamingBody())
+	require.NoError(t, err)
+	assert.Equal(t, "/second", r.RequestLine.RequestTarget)
+}
+
+func TestRequestFromReader_BufferedBodyReader(t *testing.T) {
+	r, err := RequestFromReader(strings.NewReader("POST / HTTP/1.1\r\nHost: localhost:42069\r\nContent-Length: 5\r\n\r\nhello"))
+	require.NoError(t, err)
+
+	body, err := io.ReadAll(r.BodyReader)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(body))
+	assert.Equal(t, "hello", string(r.Body))
+}
+
+// Context Tests
+type contextKey string
+
+func TestRequest_Context(t *testing.T) {
+	r, err := RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\nHost: localhost:42069\r\n\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, context.Background(), r.Context())
+
+	ctx := context.WithValue(context.Background(), contextKey("user"), "alice")
+	r2 := r.WithContext(ctx)
+	assert.Equal(t, "alice", r2.Context().Value(contextKey("user")))
+	assert.Equal(t, context.Background(), r.Context())
+	assert.Equal(t, r.RequestLine, r2.RequestLine)
+}
@@ -0,0 +1,379 @@
+package request
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+)
+
+// ErrInvalidTarget is returned for request targets that are not valid
+// URIs (RFC 3986) or not allowed for the request method
+var ErrInvalidTarget = errors.New("invalid request target")
+
+// TargetForm is one of the four forms of request target (RFC 9112 section 3.2)
+type TargetForm int
+
+const (
+	// FormOrigin is an absolute path with an optional query, e.g. /users?page=2
+	FormOrigin TargetForm = iota
+	// FormAbsolute is a complete URI, e.g. http://example.com/users, sent to proxies
+	FormAbsolute
+	// FormAuthority is a host and port, e.g. example.com:443, only used by CONNECT
+	FormAuthority
+	// FormAsterisk is a single "*", only used by OPTIONS for the server as a whole
+	FormAsterisk
+)
+
+// URL is the parsed request target
+type URL struct {
+	Form TargetForm
+	// Scheme is set for the absolute form only
+	Scheme string
+	// Host is set for the absolute and authority forms
+	Host string
+	// Path is the percent-decoded path. It is "*" for the asterisk form and
+	// empty for the authority form.
+	Path string
+	// RawPath is the path as sent, with its percent-encoding
+	RawPath string
+	// RawQuery is the query without the leading "?", still percent-encoded
+	RawQuery string
+}
+
+// Query returns the parsed query parameters
+func (u *URL) Query() Values {
+	// The target was validated when it was parsed, so decoding can't fail
+	values, _ := ParseQuery(u.RawQuery)
+	return values
+}
+
+// String returns the request target as it was sent
+func (u *URL) String() string {
+	var b strings.Builder
+	switch u.Form {
+	case FormAbsolute:
+		b.WriteString(u.Scheme + "://" + u.Host)
+	case FormAuthority:
+		return u.Host
+	}
+	b.WriteString(u.RawPath)
+	if u.RawQuery != "" {
+		b.WriteString("?" + u.RawQuery)
+	}
+	return b.String()
+}
+
+// Values holds query or form parameters. Each key maps to its values in
+// the order they were sent.
+type Values map[string][]string
+
+// Get returns the first value for key, or an empty string if there is none
+func (v Values) Get(key string) string {
+	if vs := v[key]; len(vs) > 0 {
+		return vs[0]
+	}
+	return ""
+}
+
+// Has reports whether key is present, even with an empty value
+func (v Values) Has(key string) bool {
+	_, ok := v[key]
+	return ok
+}
+
+// Set replaces the values for key with value
+func (v Values) Set(key, value string) {
+	v[key] = []string{value}
+}
+
+// Add appends value to the values for key
+func (v Values) Add(key, value string) {
+	v[key] = append(v[key], value)
+}
+
+// Del removes all values for key
+func (v Values) Del(key string) {
+	delete(v, key)
+}
+
+// Encode returns the values as a query string sorted by key
+func (v Values) Encode() string {
+	keys := make([]string, 0, len(v))
+	for key := range v {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, key := range keys {
+		for _, value := range v[key] {
+			if b.Len() > 0 {
+				b.WriteByte('&')
+			}
+			b.WriteString(queryEscape(key))
+			b.WriteByte('=')
+			b.WriteString(queryEscape(value))
+		}
+	}
+	return b.String()
+}
+
+// ParseQuery parses a query string of "&" separated key=value pairs,
+// decoding "+" as a space and percent-encoded bytes. Keys without "=" get
+// an empty value. The first malformed escape is returned as an error along
+// with the pairs that could be decoded.
+func ParseQuery(query string) (Values, error) {
+	values := make(Values)
+	var firstErr error
+
+	for _, pair := range strings.Split(query, "&") {
+		if pair == "" {
+			continue
+		}
+
+		rawKey, rawValue, _ := strings.Cut(pair, "=")
+		key, err := unescape(strings.ReplaceAll(rawKey, "+", " "))
+		if err != nil {
+			firstErr = firstError(firstErr, err)
+			continue
+		}
+		value, err := unescape(strings.ReplaceAll(rawValue, "+", " "))
+		if err != nil {
+			firstErr = firstError(firstErr, err)
+			continue
+		}
+
+		values.Add(key, value)
+	}
+
+	return values, firstErr
+}
+
+// Returns err unless an earlier error was already recorded
+func firstError(first, err error) error {
+	if first != nil {
+		return first
+	}
+	return err
+}
+
+// Parses a request target into its form, validating that it is allowed
+// for method
+func parseTarget(method, target string) (URL, error) {
+	switch {
+	case target == "*":
+		if method != "OPTIONS" {
+			return URL{}, fmt.Errorf("%w: asterisk form is only allowed for OPTIONS", ErrInvalidTarget)
+		}
+		return URL{Form: FormAsterisk, Path: "*", RawPath: "*"}, nil
+
+	case method == "CONNECT":
+		if err := validateAuthority(target, true); err != nil {
+			return URL{}, err
+		}
+		return URL{Form: FormAuthority, Host: target}, nil
+
+	case strings.HasPrefix(target, "/"):
+		u := URL{Form: FormOrigin}
+		if err := u.setPathAndQuery(target); err != nil {
+			return URL{}, err
+		}
+		return u, nil
+
+	default:
+		return parseAbsoluteTarget(target)
+	}
+}
+
+// Parses scheme "://" authority path-abempty [ "?" query ]
+func parseAbsoluteTarget(target string) (URL, error) {
+	scheme, rest, ok := strings.Cut(target, "://")
+	if !ok || !isScheme(scheme) {
+		return URL{}, fmt.Errorf("%w: %q is neither an absolute path nor an absolute URI", ErrInvalidTarget, target)
+	}
+
+	end := strings.IndexAny(rest, "/?")
+	if end == -1 {
+		end = len(rest)
+	}
+	authority := rest[:end]
+
+	if err := validateAuthority(authority, false); err != nil {
+		return URL{}, err
+	}
+
+	u := URL{Form: FormAbsolute, Scheme: strings.ToLower(scheme), Host: authority}
+	if err := u.setPathAndQuery(rest[end:]); err != nil {
+		return URL{}, err
+	}
+
+	// An empty path is the root of the host (RFC 9110 section 4.2.3)
+	if u.RawPath == "" {
+		u.RawPath, u.Path = "/", "/"
+	}
+
+	return u, nil
+}
+
+func (u *URL) setPathAndQuery(s string) error {
+	rawPath, rawQuery, _ := strings.Cut(s, "?")
+
+	for i := 0; i < len(rawPath); i++ {
+		if c := rawPath[i]; c != '%' && c != '/' && !isPathChar(c) {
+			return fmt.Errorf("%w: invalid character %q in path", ErrInvalidTarget, c)
+		}
+	}
+
+	for i := 0; i < len(rawQuery); i++ {
+		if c := rawQuery[i]; c != '%' && c != '/' && c != '?' && !isPathChar(c) {
+			return fmt.Errorf("%w: invalid character %q in query", ErrInvalidTarget, c)
+		}
+	}
+
+	path, err := unescape(rawPath)
+	if err != nil {
+		return err
+	}
+	if _, err := unescape(rawQuery); err != nil {
+		return err
+	}
+
+	u.Path = path
+	u.RawPath = rawPath
+	u.RawQuery = rawQuery
+	return nil
+}
+
+// Validates host [ ":" port ]. User information is rejected since it is
+// deprecated in http(s) URIs (RFC 9110 section 4.2.4).
+func validateAuthority(authority string, portRequired bool) error {
+	if strings.Contains(authority, "@") {
+		return fmt.Errorf("%w: user information is not allowed in %q", ErrInvalidTarget, authority)
+	}
+
+	host, port := authority, ""
+	if h, p, err := net.SplitHostPort(authority); err == nil {
+		host, port = h, p
+		if port == "" || strings.Trim(port, "0123456789") != "" {
+			return fmt.Errorf("%w: invalid port in %q", ErrInvalidTarget, authority)
+		}
+	} else if portRequired {
+		return fmt.Errorf("%w: %q is not host:port", ErrInvalidTarget, authority)
+	}
+
+	if host == "" {
+		return fmt.Errorf("%w: missing host in %q", ErrInvalidTarget, authority)
+	}
+
+	if strings.HasPrefix(authority, "[") {
+		if net.ParseIP(strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")) == nil {
+			return fmt.Errorf("%w: invalid IP literal in %q", ErrInvalidTarget, authority)
+		}
+		return nil
+	}
+
+	for i := 0; i < len(host); i++ {
+		// reg-name allows pct-encoded too, but no registered name needs it
+		c := host[i]
+		if c == ':' || c == '@' || !isPathChar(c) {
+			return fmt.Errorf("%w: invalid character %q in host", ErrInvalidTarget, c)
+		}
+	}
+
+	return nil
+}
+
+// scheme = ALPHA *( ALPHA / DIGIT / "+" / "-" / "." )
+func isScheme(s string) bool {
+	if s == "" || !isAlpha(s[0]) {
+		return false
+	}
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		if !isAlpha(c) && !isDigit(c) && c != '+' && c != '-' && c != '.' {
+			return false
+		}
+	}
+	return true
+}
+
+// pchar without pct-encoded: unreserved / sub-delims / ":" / "@" (RFC 3986 section 3.3)
+func isPathChar(c byte) bool {
+	switch {
+	case isAlpha(c) || isDigit(c):
+		return true
+	case strings.IndexByte("-._~!$&'()*+,;=:@", c) >= 0:
+		return true
+	default:
+		return false
+	}
+}
+
+func isAlpha(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// PathUnescape decodes the percent-encoded bytes of a path or a path
+// segment, e.g. one taken from URL.RawPath
+func PathUnescape(s string) (string, error) {
+	return unescape(s)
+}
+
+// Decodes percent-encoded bytes, rejecting "%" not followed by two hex digits
+func unescape(s string) (string, error) {
+	if !strings.Contains(s, "%") {
+		return s, nil
+	}
+
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		if i+2 >= len(s) || !isHex(s[i+1]) || !isHex(s[i+2]) {
+			end := min(i+3, len(s))
+			return "", fmt.Errorf("%w: malformed escape %q", ErrInvalidTarget, s[i:end])
+		}
+		b.WriteByte(unhex(s[i+1])<<4 | unhex(s[i+2]))
+		i += 2
+	}
+
+	return b.String(), nil
+}
+
+// Percent-encodes everything but unreserved characters, with spaces as "+"
+func queryEscape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case isAlpha(c) || isDigit(c) || strings.IndexByte("-._~", c) >= 0:
+			b.WriteByte(c)
+		case c == ' ':
+			b.WriteByte('+')
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func isHex(c byte) bool {
+	return isDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func unhex(c byte) byte {
+	switch {
+	case isDigit(c):
+		return c - '0'
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
@@ -0,0 +1,129 @@
+package request
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Request Target Tests
+func TestRequestFromReader_TargetForms(t *testing.T) {
+	testCases := []struct {
+		name     string
+		line     string
+		expected URL
+	}{
+		{
+			name:     "origin form",
+			line:     "GET /users/a%20b/posts?page=2&sort=new HTTP/1.1",
+			expected: URL{Form: FormOrigin, Path: "/users/a b/posts", RawPath: "/users/a%20b/posts", RawQuery: "page=2&sort=new"},
+		},
+		{
+			name:     "encoded slash",
+			line:     "GET /files/a%2Fb HTTP/1.1",
+			expected: URL{Form: FormOrigin, Path: "/files/a/b", RawPath: "/files/a%2Fb"},
+		},
+		{
+			name:     "absolute form",
+			line:     "GET HTTP://example.com:8080/index.html?q=1 HTTP/1.1",
+			expected: URL{Form: FormAbsolute, Scheme: "http", Host: "example.com:8080", Path: "/index.html", RawPath: "/index.html", RawQuery: "q=1"},
+		},
+		{
+			name:     "absolute form without path",
+			line:     "GET http://[::1] HTTP/1.1",
+			expected: URL{Form: FormAbsolute, Scheme: "http", Host: "[::1]", Path: "/", RawPath: "/"},
+		},
+		{
+			name:     "authority form",
+			line:     "CONNECT example.com:443 HTTP/1.1",
+			expected: URL{Form: FormAuthority, Host: "example.com:443"},
+		},
+		{
+			name:     "asterisk form",
+			line:     "OPTIONS * HTTP/1.1",
+			expected: URL{Form: FormAsterisk, Path: "*", RawPath: "*"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := RequestFromReader(strings.NewReader(tc.line + "\r\nHost: localhost\r\n\r\n"))
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, r.URL)
+		})
+	}
+}
+
+func TestRequestFromReader_InvalidTargets(t *testing.T) {
+	for _, line := range []string{
+		"GET /bad%zzescape HTTP/1.1",
+		"GET /truncated%2 HTTP/1.1",
+		"GET /search?q=%G1 HTTP/1.1",
+		"GET /page#fragment HTTP/1.1",
+		"GET /quote\" HTTP/1.1",
+		"GET users HTTP/1.1",
+		"GET * HTTP/1.1",
+		"GET http://user@example.com/ HTTP/1.1",
+		"GET http:///nohost HTTP/1.1",
+		"GET 1http://example.com/ HTTP/1.1",
+		"CONNECT example.com HTTP/1.1",
+		"CONNECT example.com:https HTTP/1.1",
+		"CONNECT /path HTTP/1.1",
+	} {
+		_, err := RequestFromReader(strings.NewReader(line + "\r\nHost: localhost\r\n\r\n"))
+		require.ErrorIs(t, err, ErrInvalidTarget, line)
+	}
+}
+
+func TestURL_String(t *testing.T) {
+	for _, target := range []string{"/a%20b?x=1", "http://example.com/", "example.com:443", "*"} {
+		method := "GET"
+		switch target {
+		case "example.com:443":
+			method = "CONNECT"
+		case "*":
+			method = "OPTIONS"
+		}
+
+		u, err := parseTarget(method, target)
+		require.NoError(t, err)
+		assert.Equal(t, target, u.String())
+	}
+}
+
+// Query Tests
+func TestURL_Query(t *testing.T) {
+	u := URL{RawQuery: "a=1&b=2&a=3&empty=&flag&sp=x+y%21&&%26k=v%3D"}
+	q := u.Query()
+
+	assert.Equal(t, []string{"1", "3"}, q["a"])
+	assert.Equal(t, "1", q.Get("a"))
+	assert.Equal(t, "2", q.Get("b"))
+	assert.True(t, q.Has("empty"))
+	assert.True(t, q.Has("flag"))
+	assert.False(t, q.Has("missing"))
+	assert.Equal(t, "x y!", q.Get("sp"))
+	assert.Equal(t, "v=", q.Get("&k"))
+}
+
+func TestParseQuery_MalformedEscape(t *testing.T) {
+	q, err := ParseQuery("a=1&b=%zz&c=3")
+	require.ErrorIs(t, err, ErrInvalidTarget)
+	assert.Equal(t, Values{"a": {"1"}, "c": {"3"}}, q)
+}
+
+func TestValues_Encode(t *testing.T) {
+	v := Values{}
+	v.Add("b", "x y")
+	v.Add("a", "1&2")
+	v.Add("b", "z")
+	v.Set("c", "ü")
+
+	assert.Equal(t, "a=1%262&b=x+y&b=z&c=%C3%BC", v.Encode())
+
+	q, err := ParseQuery(v.Encode())
+	require.NoError(t, err)
+	assert.Equal(t, v, q)
+}
@@ -0,0 +1,114 @@
+package response
+
+import (
+	"fmt"
+	"http-server/internal/headers"
+	"strings"
+)
+
+// WriteChunkedBody writes p as a single chunk. The headers must have set
+// Transfer-Encoding: chunked. Empty writes are skipped since a zero sized
+// chunk marks the end of the body.
+func (w *Writer) WriteChunkedBody(p []byte) (int, error) {
+	if w.state != writerStateBody {
+		return 0, fmt.Errorf("%w: cannot write chunked body while writing %s", ErrWriterState, w.state)
+	}
+
+	if !w.chunked {
+		return 0, fmt.Errorf("%w: Transfer-Encoding: chunked header not set", ErrWriterState)
+	}
+
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	if w.omitBody {
+		w.bodyWritten += len(p)
+		return len(p), nil
+	}
+
+	if w.unchunked {
+		n, err := w.writer.Write(p)
+		w.bodyWritten += n
+		return n, err
+	}
+
+	chunk := make([]byte, 0, len(p)+16)
+	chunk = fmt.Appendf(chunk, "%x%s", len(p), crlf)
+	chunk = append(chunk, p...)
+	chunk = append(chunk, crlf...)
+
+	if _, err := w.writer.Write(chunk); err != nil {
+		return 0, err
+	}
+
+	w.bodyWritten += len(p)
+	return len(p), nil
+}
+
+// WriteChunkedBodyDone writes the last chunk. When the headers declared
+// trailers with the Trailer header, WriteTrailers must be called afterwards
+// to finish the response.
+func (w *Writer) WriteChunkedBodyDone() (int, error) {
+	if w.state != writerStateBody {
+		return 0, fmt.Errorf("%w: cannot finish chunked body while writing %s", ErrWriterState, w.state)
+	}
+
+	if !w.chunked {
+		return 0, fmt.Errorf("%w: Transfer-Encoding: chunked header not set", ErrWriterState)
+	}
+
+	if w.unchunked || w.omitBody {
+		w.state = writerStateDone
+		return 0, nil
+	}
+
+	lastChunk := "0" + crlf
+	w.state = writerStateTrailers
+	if len(w.trailers) == 0 {
+		lastChunk += crlf
+		w.state = writerStateDone
+	}
+
+	return w.writer.Write([]byte(lastChunk))
+}
+
+// WriteTrailers writes the trailer section after the last chunk. Only
+// fields declared in the Trailer header may be sent. Trailers are dropped
+// for HTTP/1.0 clients and responses without a body.
+func (w *Writer) WriteTrailers(h *headers.Headers) error {
+	if (w.unchunked || w.omitBody) && w.state == writerStateDone {
+		return nil
+	}
+
+	if w.state != writerStateTrailers {
+		return fmt.Errorf("%w: cannot write trailers while writing %s", ErrWriterState, w.state)
+	}
+
+	for key := range h.All() {
+		if !w.trailers[strings.ToLower(key)] {
+			return fmt.Errorf("trailer %s was not declared in the Trailer header", headers.CanonicalKey(key))
+		}
+	}
+
+	if err := WriteHeader(w.writer, h); err != nil {
+		return err
+	}
+
+	w.state = writerStateDone
+	return nil
+}
+
+// Parses the comma separated field names of a Trailer header
+func parseTrailerNames(value string) map[string]bool {
+	names := make(map[string]bool)
+
+	for _, name := range strings.Split(value, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != "" {
+			names[name] = true
+		}
+	}
+
+	return names
+}
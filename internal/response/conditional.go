@@ -0,0 +1,178 @@
+package response
+
+import (
+	"http-server/internal/headers"
+	"http-server/internal/request"
+	"log"
+	"strings"
+	"time"
+)
+
+// StrongETag returns a strong entity tag for opaque, which must not
+// contain double quotes. Strong tags change whenever the content changes.
+func StrongETag(opaque string) string {
+	return `"` + opaque + `"`
+}
+
+// WeakETag returns a weak entity tag for opaque, for representations that
+// are only semantically equivalent when their tags match
+func WeakETag(opaque string) string {
+	return `W/"` + opaque + `"`
+}
+
+// EvaluatePreconditions evaluates the conditional headers of req against
+// the current representation's entity tag and modification time, in the
+// order of RFC 9110 section 13.2.2. Either may be empty or zero when
+// unknown. It returns StatusSuccess when the request should be served
+// normally, StatusNotModified when the client's cached copy is current,
+// or StatusPreconditionFailed.
+func EvaluatePreconditions(req *request.Request, etag string, lastModified time.Time) StatusCode {
+	h := req.Headers
+	lastModified = lastModified.Truncate(time.Second)
+	safe := req.RequestLine.Method == "GET" || req.RequestLine.Method == "HEAD"
+
+	if h.Has("if-match") {
+		if !etagMatches(h.Get("if-match"), etag, true) {
+			return StatusPreconditionFailed
+		}
+	} else if date, ok := ParseTime(h.Get("if-unmodified-since")); ok && !lastModified.IsZero() {
+		if lastModified.After(date) {
+			return StatusPreconditionFailed
+		}
+	}
+
+	if h.Has("if-none-match") {
+		if etagMatches(h.Get("if-none-match"), etag, false) {
+			if safe {
+				return StatusNotModified
+			}
+			return StatusPreconditionFailed
+		}
+	} else if date, ok := ParseTime(h.Get("if-modified-since")); ok && safe && !lastModified.IsZero() {
+		if !lastModified.After(date) {
+			return StatusNotModified
+		}
+	}
+
+	return StatusSuccess
+}
+
+// CheckPreconditions evaluates the conditional headers of req like
+// EvaluatePreconditions and, unless the request should be served
+// normally, writes the complete 304 Not Modified or 412 Precondition
+// Failed response. It reports whether a response was written, in which
+// case the handler must not write anything else.
+func CheckPreconditions(w *Writer, req *request.Request, etag string, lastModified time.Time) bool {
+	statusCode := EvaluatePreconditions(req, etag, lastModified)
+
+	switch statusCode {
+	case StatusSuccess:
+		return false
+	case StatusNotModified:
+		if err := w.WriteStatusLine(statusCode); err != nil {
+			log.Printf("Error writing status line: %v", err)
+			return true
+		}
+
+		h := headers.NewHeaders()
+		SetValidators(h, etag, lastModified)
+		if err := w.WriteHeaders(h); err != nil {
+			log.Printf("Error writing headers: %v", err)
+		}
+	default:
+		WriteStatus(w, statusCode, nil)
+	}
+
+	return true
+}
+
+// SetValidators sets the ETag and Last-Modified headers, skipping an
+// empty etag or zero lastModified
+func SetValidators(h *headers.Headers, etag string, lastModified time.Time) {
+	if etag != "" {
+		h.Set("ETag", etag)
+	}
+	if !lastModified.IsZero() {
+		h.Set("Last-Modified", lastModified.UTC().Format(TimeFormat))
+	}
+}
+
+// Date formats recipients must accept (RFC 9110 section 5.6.7): the
+// preferred IMF-fixdate and the obsolete RFC 850 and asctime formats
+var timeFormats = []string{
+	TimeFormat,
+	"Monday, 02-Jan-06 15:04:05 GMT",
+	"Mon Jan _2 15:04:05 2006",
+}
+
+// ParseTime parses an HTTP date, reporting false for invalid dates
+func ParseTime(value string) (time.Time, bool) {
+	for _, layout := range timeFormats {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// Reports whether the If-Match or If-None-Match value matches etag. "*"
+// matches any current representation. Strong comparison requires both
+// tags to be strong; weak comparison ignores the W/ prefix (RFC 9110
+// section 8.8.3.2).
+func etagMatches(value, etag string, strong bool) bool {
+	value = strings.TrimSpace(value)
+	if value == "*" {
+		return etag != ""
+	}
+	if etag == "" {
+		return false
+	}
+
+	for _, candidate := range parseETags(value) {
+		if strong {
+			if !isWeak(candidate) && !isWeak(etag) && candidate == etag {
+				return true
+			}
+			continue
+		}
+		if strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+func isWeak(etag string) bool {
+	return strings.HasPrefix(etag, "W/")
+}
+
+// Splits a comma separated list of entity tags. Tags may contain commas
+// inside their quotes, so the list is scanned rather than split.
+// Malformed entries end the list.
+func parseETags(value string) []string {
+	var etags []string
+
+	for {
+		value = strings.TrimLeft(value, " \t,")
+		if value == "" {
+			return etags
+		}
+
+		start := 0
+		if strings.HasPrefix(value, "W/") {
+			start = 2
+		}
+		if len(value) <= start || value[start] != '"' {
+			return etags
+		}
+
+		end := strings.IndexByte(value[start+1:], '"')
+		if end == -1 {
+			return etags
+		}
+		end += start + 2
+
+		etags = append(etags, value[:end])
+		value = value[end:]
+	}
+}
@@ -0,0 +1,127 @@
+package response
+
+import (
+	"bytes"
+	"http-server/internal/request"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	testModTime = time.Date(2024, time.March, 10, 12, 0, 0, 0, time.UTC)
+	testETag    = StrongETag("abc")
+)
+
+func conditionalRequest(t *testing.T, method, fields string) *request.Request {
+	t.Helper()
+
+	req, err := request.RequestFromReader(strings.NewReader(method + " / HTTP/1.1\r\nHost: localhost\r\n" + fields + "\r\n"))
+	require.NoError(t, err)
+	return req
+}
+
+func TestEvaluatePreconditions(t *testing.T) {
+	before := testModTime.Add(-time.Hour).Format(TimeFormat)
+	after := testModTime.Add(time.Hour).Format(TimeFormat)
+	exact := testModTime.Format(TimeFormat)
+
+	testCases := []struct {
+		name     string
+		method   string
+		fields   string
+		expected StatusCode
+	}{
+		{name: "no conditions", method: "GET", expected: StatusSuccess},
+		{name: "if-none-match matches", method: "GET", fields: "If-None-Match: \"abc\"\r\n", expected: StatusNotModified},
+		{name: "if-none-match weak comparison", method: "GET", fields: "If-None-Match: W/\"abc\"\r\n", expected: StatusNotModified},
+		{name: "if-none-match list", method: "GET", fields: "If-None-Match: \"x,y\", \"abc\"\r\n", expected: StatusNotModified},
+		{name: "if-none-match differs", method: "GET", fields: "If-None-Match: \"xyz\"\r\n", expected: StatusSuccess},
+		{name: "if-none-match star", method: "HEAD", fields: "If-None-Match: *\r\n", expected: StatusNotModified},
+		{name: "if-none-match unsafe method", method: "PUT", fields: "If-None-Match: \"abc\"\r\n", expected: StatusPreconditionFailed},
+		{name: "if-modified-since not modified", method: "GET", fields: "If-Modified-Since: " + exact + "\r\n", expected: StatusNotModified},
+		{name: "if-modified-since modified", method: "GET", fields: "If-Modified-Since: " + before + "\r\n", expected: StatusSuccess},
+		{name: "if-modified-since invalid date", method: "GET", fields: "If-Modified-Since: yesterday\r\n", expected: StatusSuccess},
+		{name: "if-modified-since ignored for post", method: "POST", fields: "If-Modified-Since: " + after + "\r\n", expected: StatusSuccess},
+		{name: "if-none-match overrides if-modified-since", method: "GET", fields: "If-None-Match: \"xyz\"\r\nIf-Modified-Since: " + after + "\r\n", expected: StatusSuccess},
+		{name: "if-match matches", method: "PUT", fields: "If-Match: \"x\", \"abc\"\r\n", expected: StatusSuccess},
+		{name: "if-match differs", method: "PUT", fields: "If-Match: \"xyz\"\r\n", expected: StatusPreconditionFailed},
+		{name: "if-match strong comparison", method: "PUT", fields: "If-Match: W/\"abc\"\r\n", expected: StatusPreconditionFailed},
+		{name: "if-match star", method: "PUT", fields: "If-Match: *\r\n", expected: StatusSuccess},
+		{name: "if-unmodified-since unmodified", method: "PUT", fields: "If-Unmodified-Since: " + exact + "\r\n", expected: StatusSuccess},
+		{name: "if-unmodified-since modified", method: "PUT", fields: "If-Unmodified-Since: " + before + "\r\n", expected: StatusPreconditionFailed},
+		{name: "if-match overrides if-unmodified-since", method: "PUT", fields: "If-Match: \"abc\"\r\nIf-Unmodified-Since: " + before + "\r\n", expected: StatusSuccess},
+		{name: "if-match checked before if-none-match", method: "GET", fields: "If-Match: \"xyz\"\r\nIf-None-Match: \"abc\"\r\n", expected: StatusPreconditionFailed},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := conditionalRequest(t, tc.method, tc.fields)
+			assert.Equal(t, tc.expected, EvaluatePreconditions(req, testETag, testModTime.Add(500*time.Millisecond)))
+		})
+	}
+}
+
+func TestEvaluatePreconditions_UnknownValidators(t *testing.T) {
+	req := conditionalRequest(t, "GET", "If-None-Match: *\r\nIf-Modified-Since: "+testModTime.Format(TimeFormat)+"\r\n")
+	assert.Equal(t, StatusSuccess, EvaluatePreconditions(req, "", time.Time{}))
+
+	req = conditionalRequest(t, "PUT", "If-Match: *\r\n")
+	assert.Equal(t, StatusPreconditionFailed, EvaluatePreconditions(req, "", time.Time{}))
+}
+
+func TestCheckPreconditions_NotModified(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	req := conditionalRequest(t, "GET", "If-None-Match: \"abc\"\r\n")
+
+	require.True(t, CheckPreconditions(w, req, testETag, testModTime))
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 304 Not Modified\r\nConnection: close\r\nETag: \"abc\"\r\nLast-Modified: Sun, 10 Mar 2024 12:00:00 GMT\r\n\r\n", buf.String())
+}
+
+func TestCheckPreconditions_PreconditionFailed(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	req := conditionalRequest(t, "PUT", "If-Match: \"xyz\"\r\n")
+
+	require.True(t, CheckPreconditions(w, req, testETag, testModTime))
+	require.NoError(t, w.Finish())
+	assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.1 412 Precondition Failed\r\n"), buf.String())
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\nPrecondition Failed\n"), buf.String())
+}
+
+func TestCheckPreconditions_Success(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	req := conditionalRequest(t, "GET", "If-None-Match: \"xyz\"\r\n")
+
+	assert.False(t, CheckPreconditions(w, req, testETag, testModTime))
+	assert.Empty(t, buf.String())
+}
+
+func TestParseTime(t *testing.T) {
+	expected := time.Date(1994, time.November, 6, 8, 49, 37, 0, time.UTC)
+
+	for _, value := range []string{
+		"Sun, 06 Nov 1994 08:49:37 GMT",
+		"Sunday, 06-Nov-94 08:49:37 GMT",
+		"Sun Nov  6 08:49:37 1994",
+	} {
+		parsed, ok := ParseTime(value)
+		require.True(t, ok, value)
+		assert.True(t, expected.Equal(parsed), value)
+	}
+
+	_, ok := ParseTime("06 Nov 1994")
+	assert.False(t, ok)
+}
+
+func TestParseETags(t *testing.T) {
+	assert.Equal(t, []string{`"a"`, `W/"b,c"`, `""`}, parseETags(` "a",W/"b,c" , ""`))
+	assert.Equal(t, []string{`"a"`}, parseETags(`"a", b, "c"`))
+	assert.Empty(t, parseETags(`"unterminated`))
+}
@@ -0,0 +1,184 @@
+package response
+
+import (
+	"errors"
+	"fmt"
+	"http-server/internal/headers"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidCookie is returned for cookies that cannot be sent in a Set-Cookie header
+var ErrInvalidCookie = errors.New("invalid cookie")
+
+// SameSite controls whether a cookie is sent with cross-site requests
+type SameSite int
+
+const (
+	// SameSiteDefault omits the attribute, leaving the choice to the browser
+	SameSiteDefault SameSite = iota
+	SameSiteLax
+	SameSiteStrict
+	// SameSiteNone requires the cookie to be Secure
+	SameSiteNone
+)
+
+func (s SameSite) String() string {
+	switch s {
+	case SameSiteLax:
+		return "Lax"
+	case SameSiteStrict:
+		return "Strict"
+	case SameSiteNone:
+		return "None"
+	default:
+		return ""
+	}
+}
+
+// Cookie is a cookie set with a Set-Cookie header (RFC 6265 section 4.1)
+type Cookie struct {
+	Name  string
+	Value string
+
+	Path   string
+	Domain string
+	// Expires is omitted when zero
+	Expires time.Time
+	// MaxAge is the lifetime in seconds. Zero omits the attribute and a
+	// negative value deletes the cookie with Max-Age=0.
+	MaxAge   int
+	Secure   bool
+	HttpOnly bool
+	SameSite SameSite
+	// Partitioned stores the cookie per top-level site (CHIPS) and requires Secure
+	Partitioned bool
+}
+
+// String returns the Set-Cookie header value, or an empty string when
+// the cookie is not valid
+func (c *Cookie) String() string {
+	if c.Valid() != nil {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString(c.Name + "=" + c.Value)
+
+	if c.Path != "" {
+		b.WriteString("; Path=" + c.Path)
+	}
+	if c.Domain != "" {
+		b.WriteString("; Domain=" + strings.TrimPrefix(c.Domain, "."))
+	}
+	if !c.Expires.IsZero() {
+		b.WriteString("; Expires=" + c.Expires.UTC().Format(TimeFormat))
+	}
+	if c.MaxAge > 0 {
+		b.WriteString("; Max-Age=" + strconv.Itoa(c.MaxAge))
+	} else if c.MaxAge < 0 {
+		b.WriteString("; Max-Age=0")
+	}
+	if c.Secure {
+		b.WriteString("; Secure")
+	}
+	if c.HttpOnly {
+		b.WriteString("; HttpOnly")
+	}
+	if c.SameSite != SameSiteDefault {
+		b.WriteString("; SameSite=" + c.SameSite.String())
+	}
+	if c.Partitioned {
+		b.WriteString("; Partitioned")
+	}
+
+	return b.String()
+}
+
+// SetCookie adds a Set-Cookie field line for c to h
+func SetCookie(h *headers.Headers, c *Cookie) error {
+	if err := c.Valid(); err != nil {
+		return err
+	}
+
+	h.Add("Set-Cookie", c.String())
+	return nil
+}
+
+// Valid returns an error naming the first part of the cookie that cannot
+// be sent, including attribute combinations browsers reject
+func (c *Cookie) Valid() error {
+	if !isCookieName(c.Name) {
+		return fmt.Errorf("%w: name %q is not a token", ErrInvalidCookie, c.Name)
+	}
+
+	for _, ch := range []byte(c.Value) {
+		if !isCookieOctet(ch) {
+			return fmt.Errorf("%w: invalid character %q in value of %s", ErrInvalidCookie, ch, c.Name)
+		}
+	}
+
+	for _, ch := range []byte(c.Path) {
+		if ch < 0x20 || ch == 0x7f || ch == ';' {
+			return fmt.Errorf("%w: invalid character %q in path of %s", ErrInvalidCookie, ch, c.Name)
+		}
+	}
+
+	if c.Domain != "" && !isCookieDomain(strings.TrimPrefix(c.Domain, ".")) {
+		return fmt.Errorf("%w: invalid domain %q for %s", ErrInvalidCookie, c.Domain, c.Name)
+	}
+
+	if c.SameSite < SameSiteDefault || c.SameSite > SameSiteNone {
+		return fmt.Errorf("%w: unknown SameSite value %d for %s", ErrInvalidCookie, c.SameSite, c.Name)
+	}
+
+	// Browsers reject these cookies when they are not Secure
+	if !c.Secure && (c.SameSite == SameSiteNone || c.Partitioned || strings.HasPrefix(c.Name, "__Secure-") || strings.HasPrefix(c.Name, "__Host-")) {
+		return fmt.Errorf("%w: %s must be Secure", ErrInvalidCookie, c.Name)
+	}
+
+	if strings.HasPrefix(c.Name, "__Host-") && (c.Domain != "" || c.Path != "/") {
+		return fmt.Errorf("%w: %s must have Path=/ and no Domain", ErrInvalidCookie, c.Name)
+	}
+
+	return nil
+}
+
+// cookie-name = token (RFC 6265 section 4.1.1)
+func isCookieName(name string) bool {
+	if name == "" {
+		return false
+	}
+
+	for _, c := range []byte(name) {
+		if c <= ' ' || c >= 0x7f || strings.IndexByte(`()<>@,;:\"/[]?={}`, c) >= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// cookie-octet = %x21 / %x23-2B / %x2D-3A / %x3C-5B / %x5D-7E
+func isCookieOctet(c byte) bool {
+	return c >= 0x21 && c <= 0x7e && c != '"' && c != ',' && c != ';' && c != '\\'
+}
+
+// Reports whether domain is a host name of letters, digits, hyphens and dots
+func isCookieDomain(domain string) bool {
+	if domain == "" || len(domain) > 253 {
+		return false
+	}
+
+	for _, label := range strings.Split(domain, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range []byte(label) {
+			if !(c >= 'a' && c <= 'z') && !(c >= 'A' && c <= 'Z') && !(c >= '0' && c <= '9') && c != '-' {
+				return false
+			}
+		}
+	}
+	return true
+}
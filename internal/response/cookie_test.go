@@ -0,0 +1,77 @@
+package response
+
+import (
+	"http-server/internal/headers"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCookie_String(t *testing.T) {
+	testCases := []struct {
+		name     string
+		cookie   Cookie
+		expected string
+	}{
+		{name: "name and value", cookie: Cookie{Name: "id", Value: "a3fWa"}, expected: "id=a3fWa"},
+		{name: "empty value", cookie: Cookie{Name: "id"}, expected: "id="},
+		{
+			name: "all attributes",
+			cookie: Cookie{
+				Name: "session", Value: "xyz", Path: "/app", Domain: ".example.com",
+				Expires: time.Date(2026, 10, 21, 9, 28, 0, 0, time.FixedZone("CEST", 2*60*60)),
+				MaxAge:  3600, Secure: true, HttpOnly: true, SameSite: SameSiteStrict, Partitioned: true,
+			},
+			expected: "session=xyz; Path=/app; Domain=example.com; Expires=Wed, 21 Oct 2026 07:28:00 GMT; Max-Age=3600; Secure; HttpOnly; SameSite=Strict; Partitioned",
+		},
+		{name: "delete", cookie: Cookie{Name: "id", MaxAge: -1}, expected: "id=; Max-Age=0"},
+		{name: "lax", cookie: Cookie{Name: "id", Value: "1", SameSite: SameSiteLax}, expected: "id=1; SameSite=Lax"},
+		{name: "host prefix", cookie: Cookie{Name: "__Host-id", Value: "1", Path: "/", Secure: true}, expected: "__Host-id=1; Path=/; Secure"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.NoError(t, tc.cookie.Valid())
+			assert.Equal(t, tc.expected, tc.cookie.String())
+		})
+	}
+}
+
+func TestCookie_Invalid(t *testing.T) {
+	testCases := []struct {
+		name   string
+		cookie Cookie
+	}{
+		{name: "empty name", cookie: Cookie{Value: "x"}},
+		{name: "separator in name", cookie: Cookie{Name: "a=b"}},
+		{name: "space in name", cookie: Cookie{Name: "a b"}},
+		{name: "semicolon in value", cookie: Cookie{Name: "a", Value: "x;y"}},
+		{name: "comma in value", cookie: Cookie{Name: "a", Value: "x,y"}},
+		{name: "space in value", cookie: Cookie{Name: "a", Value: "x y"}},
+		{name: "semicolon in path", cookie: Cookie{Name: "a", Path: "/x;Domain=evil.com"}},
+		{name: "invalid domain", cookie: Cookie{Name: "a", Domain: "exa mple.com"}},
+		{name: "same site none without secure", cookie: Cookie{Name: "a", SameSite: SameSiteNone}},
+		{name: "partitioned without secure", cookie: Cookie{Name: "a", Partitioned: true}},
+		{name: "secure prefix without secure", cookie: Cookie{Name: "__Secure-a"}},
+		{name: "host prefix with domain", cookie: Cookie{Name: "__Host-a", Path: "/", Domain: "example.com", Secure: true}},
+		{name: "host prefix without root path", cookie: Cookie{Name: "__Host-a", Secure: true}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.ErrorIs(t, tc.cookie.Valid(), ErrInvalidCookie)
+			assert.Empty(t, tc.cookie.String())
+			assert.ErrorIs(t, SetCookie(headers.NewHeaders(), &tc.cookie), ErrInvalidCookie)
+		})
+	}
+}
+
+func TestSetCookie_RepeatedFieldLines(t *testing.T) {
+	h := headers.NewHeaders()
+	require.NoError(t, SetCookie(h, &Cookie{Name: "a", Value: "1", Expires: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)}))
+	require.NoError(t, SetCookie(h, &Cookie{Name: "b", Value: "2"}))
+
+	assert.Equal(t, []string{"a=1; Expires=Fri, 02 Jan 2026 03:04:05 GMT", "b=2"}, h.Values("Set-Cookie"))
+}
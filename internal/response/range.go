@@ -0,0 +1,170 @@
+package response
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"http-server/internal/request"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidRange is returned for a malformed bytes Range header
+	ErrInvalidRange = errors.New("invalid range")
+	// ErrRangeNotSatisfiable is returned when no range overlaps the content
+	ErrRangeNotSatisfiable = errors.New("range not satisfiable")
+)
+
+// Many small ranges make a cheap request expensive to answer
+const maxRanges = 100
+
+// ByteRange is a satisfiable range of Length bytes starting at offset Start
+type ByteRange struct {
+	Start  int64
+	Length int64
+}
+
+// ContentRange returns the Content-Range value of r within content of size bytes
+func (r ByteRange) ContentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.Start, r.Start+r.Length-1, size)
+}
+
+// ParseRange parses a Range header value (RFC 9110 section 14.2) for
+// content of size bytes. Ranges past the end are clipped, ranges that
+// don't overlap the content are dropped and the rest are sorted, with
+// overlapping and adjacent ranges merged. It returns nil without an error
+// for an empty value or a unit other than bytes, which must be ignored,
+// and ErrRangeNotSatisfiable when no range is left. Ranges asking for
+// more bytes in total than the content has are also ignored, so the whole
+// content is sent once rather than parts of it many times over (RFC 9110
+// section 14.2).
+func ParseRange(value string, size int64) ([]ByteRange, error) {
+	unit, set, ok := strings.Cut(value, "=")
+	if !ok || !strings.EqualFold(strings.TrimSpace(unit), "bytes") {
+		return nil, nil
+	}
+
+	var specs []string
+	for spec := range strings.SplitSeq(set, ",") {
+		if spec = strings.TrimSpace(spec); spec != "" {
+			specs = append(specs, spec)
+		}
+	}
+	if len(specs) == 0 {
+		return nil, fmt.Errorf("%w: empty range set", ErrInvalidRange)
+	}
+	if len(specs) > maxRanges {
+		return nil, fmt.Errorf("%w: more than %d ranges", ErrInvalidRange, maxRanges)
+	}
+
+	var ranges []ByteRange
+	for _, spec := range specs {
+		r, ok, err := parseRangeSpec(spec, size)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			ranges = append(ranges, r)
+		}
+	}
+
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("%w: no range overlaps %d bytes", ErrRangeNotSatisfiable, size)
+	}
+
+	var total int64
+	for _, r := range ranges {
+		total += r.Length
+	}
+	if total > size {
+		return nil, nil
+	}
+
+	return mergeRanges(ranges), nil
+}
+
+// Sorts ranges by start and merges those that overlap or touch
+func mergeRanges(ranges []ByteRange) []ByteRange {
+	slices.SortFunc(ranges, func(a, b ByteRange) int { return cmp.Compare(a.Start, b.Start) })
+
+	merged := ranges[:1]
+	for _, r := range ranges[1:] {
+		last := &merged[len(merged)-1]
+		if r.Start > last.Start+last.Length {
+			merged = append(merged, r)
+			continue
+		}
+		last.Length = max(last.Length, r.Start+r.Length-last.Start)
+	}
+	return merged
+}
+
+// Parses "first-last", "first-" or "-suffix", reporting false for a
+// range that doesn't overlap the content
+func parseRangeSpec(spec string, size int64) (ByteRange, bool, error) {
+	first, last, ok := strings.Cut(spec, "-")
+	if !ok {
+		return ByteRange{}, false, fmt.Errorf("%w: %q", ErrInvalidRange, spec)
+	}
+
+	if first == "" {
+		suffix, ok := parseRangeInt(last)
+		if !ok {
+			return ByteRange{}, false, fmt.Errorf("%w: %q", ErrInvalidRange, spec)
+		}
+		if suffix == 0 || size == 0 {
+			return ByteRange{}, false, nil
+		}
+		suffix = min(suffix, size)
+		return ByteRange{Start: size - suffix, Length: suffix}, true, nil
+	}
+
+	start, ok := parseRangeInt(first)
+	if !ok {
+		return ByteRange{}, false, fmt.Errorf("%w: %q", ErrInvalidRange, spec)
+	}
+
+	end := size - 1
+	if last != "" {
+		end, ok = parseRangeInt(last)
+		if !ok || end < start {
+			return ByteRange{}, false, fmt.Errorf("%w: %q", ErrInvalidRange, spec)
+		}
+		end = min(end, size-1)
+	}
+
+	if start >= size {
+		return ByteRange{}, false, nil
+	}
+	return ByteRange{Start: start, Length: end - start + 1}, true, nil
+}
+
+// Parses a non-empty run of digits, rejecting signs and overflow
+func parseRangeInt(s string) (int64, bool) {
+	if s == "" || strings.Trim(s, "0123456789") != "" {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	return n, err == nil
+}
+
+// IfRange reports whether the Range header of req applies to the current
+// representation: either there is no If-Range header or it names the
+// current strong entity tag or exact modification time. Otherwise the
+// client's partial copy is stale and the whole content must be sent.
+func IfRange(req *request.Request, etag string, lastModified time.Time) bool {
+	if !req.Headers.Has("if-range") {
+		return true
+	}
+	value := strings.TrimSpace(req.Headers.Get("if-range"))
+
+	if strings.HasPrefix(value, `"`) || isWeak(value) {
+		return etag != "" && !isWeak(value) && !isWeak(etag) && value == etag
+	}
+
+	date, ok := ParseTime(value)
+	return ok && !lastModified.IsZero() && lastModified.Truncate(time.Second).Equal(date)
+}
@@ -0,0 +1,96 @@
+package response
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRange(t *testing.T) {
+	testCases := []struct {
+		value    string
+		expected []ByteRange
+	}{
+		{value: "bytes=0-9", expected: []ByteRange{{Start: 0, Length: 10}}},
+		{value: "bytes=10-", expected: []ByteRange{{Start: 10, Length: 90}}},
+		{value: "bytes=-10", expected: []ByteRange{{Start: 90, Length: 10}}},
+		{value: "bytes=-200", expected: []ByteRange{{Start: 0, Length: 100}}},
+		{value: "bytes=90-200", expected: []ByteRange{{Start: 90, Length: 10}}},
+		{value: "Bytes = 0-0, 5-9 ,, -1", expected: []ByteRange{{Start: 0, Length: 1}, {Start: 5, Length: 5}, {Start: 99, Length: 1}}},
+		{value: "bytes=50-59,-1,0-9", expected: []ByteRange{{Start: 0, Length: 10}, {Start: 50, Length: 10}, {Start: 99, Length: 1}}},
+		{value: "bytes=0-9,5-14,15-19", expected: []ByteRange{{Start: 0, Length: 20}}},
+		{value: "bytes=10-19,0-29", expected: []ByteRange{{Start: 0, Length: 30}}},
+		{value: "bytes=0-,0-", expected: nil},
+		{value: "bytes=0-59,40-99", expected: nil},
+		{value: "bytes=0-9,100-", expected: []ByteRange{{Start: 0, Length: 10}}},
+		{value: "", expected: nil},
+		{value: "items=0-9", expected: nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.value, func(t *testing.T) {
+			ranges, err := ParseRange(tc.value, 100)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, ranges)
+		})
+	}
+}
+
+func TestParseRange_Invalid(t *testing.T) {
+	for _, value := range []string{"bytes=", "bytes=5", "bytes=9-5", "bytes=a-b", "bytes=+1-5", "bytes=-", "bytes=1-2-3", "bytes=99999999999999999999-"} {
+		_, err := ParseRange(value, 100)
+		assert.ErrorIs(t, err, ErrInvalidRange, value)
+	}
+}
+
+func TestParseRange_NotSatisfiable(t *testing.T) {
+	for _, value := range []string{"bytes=100-", "bytes=100-200", "bytes=-0", "bytes=200-300,-0"} {
+		_, err := ParseRange(value, 100)
+		assert.ErrorIs(t, err, ErrRangeNotSatisfiable, value)
+	}
+
+	_, err := ParseRange("bytes=-5", 0)
+	assert.ErrorIs(t, err, ErrRangeNotSatisfiable)
+}
+
+func TestParseRange_TooManyRanges(t *testing.T) {
+	value := "bytes=0-0"
+	for i := range maxRanges {
+		value += fmt.Sprintf(",%d-%d", i+1, i+1)
+	}
+	_, err := ParseRange(value, 1000)
+	assert.ErrorIs(t, err, ErrInvalidRange)
+}
+
+func TestByteRange_ContentRange(t *testing.T) {
+	assert.Equal(t, "bytes 5-9/100", ByteRange{Start: 5, Length: 5}.ContentRange(100))
+}
+
+func TestIfRange(t *testing.T) {
+	testCases := []struct {
+		name     string
+		fields   string
+		expected bool
+	}{
+		{name: "absent", expected: true},
+		{name: "matching etag", fields: "If-Range: \"abc\"\r\n", expected: true},
+		{name: "other etag", fields: "If-Range: \"xyz\"\r\n", expected: false},
+		{name: "weak etag", fields: "If-Range: W/\"abc\"\r\n", expected: false},
+		{name: "matching date", fields: "If-Range: " + testModTime.Format(TimeFormat) + "\r\n", expected: true},
+		{name: "older date", fields: "If-Range: " + testModTime.Add(-time.Second).Format(TimeFormat) + "\r\n", expected: false},
+		{name: "invalid date", fields: "If-Range: yesterday\r\n", expected: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := conditionalRequest(t, "GET", tc.fields)
+			assert.Equal(t, tc.expected, IfRange(req, testETag, testModTime))
+		})
+	}
+
+	req := conditionalRequest(t, "GET", "If-Range: \"abc\"\r\n")
+	assert.False(t, IfRange(req, WeakETag("abc"), testModTime))
+}
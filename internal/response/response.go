@@ -1,63 +1,118 @@
 package response
 
 import (
+	"errors"
 	"fmt"
 	"http-server/internal/headers"
 	"io"
+	"log"
+	"sort"
+	"strconv"
 	"strings"
 )
 
-type StatusCode int
-
 const crlf = "\r\n"
 
-const (
-	StatusSuccess       StatusCode = 200
-	StatusBadRequest    StatusCode = 400
-	StatusNotFound      StatusCode = 404
-	StatusInternalError StatusCode = 500
-)
+// TimeFormat is the format of dates in header fields such as Expires (RFC 9110 section 5.6.7)
+const TimeFormat = "Mon, 02 Jan 2006 15:04:05 GMT"
 
-var statusLines = map[StatusCode][]byte{
-	StatusSuccess:       []byte("HTTP/1.1 200 OK"),
-	StatusBadRequest:    []byte("HTTP/1.1 400 Bad Request"),
-	StatusNotFound:      []byte("HTTP/1.1 404 Not Found"),
-	StatusInternalError: []byte("HTTP/1.1 500 Internal Server Error"),
+// WriteStatusLine writes an HTTP/1.1 status line for the given status code
+// with its registered reason phrase. Unregistered codes get an empty reason.
+func WriteStatusLine(w io.Writer, statusCode StatusCode) error {
+	return writeStatusLine(w, "1.1", statusCode, StatusText(statusCode))
 }
 
-func WriteStatusLine(w io.Writer, statusCode StatusCode) error {
+// WriteStatusLineWithReason writes an HTTP/1.1 status line for any 3-digit
+// status code with a custom reason phrase
+func WriteStatusLineWithReason(w io.Writer, statusCode StatusCode, reason string) error {
+	return writeStatusLine(w, "1.1", statusCode, reason)
+}
+
+func writeStatusLine(w io.Writer, httpVersion string, statusCode StatusCode, reason string) error {
 
-	statusLine, exists := statusLines[statusCode]
+	if statusCode < 100 || statusCode > 999 {
+		return fmt.Errorf("invalid status code: %d is not a 3-digit code", statusCode)
+	}
 
-	if !exists {
-		return fmt.Errorf("unsupported status code: %d", statusCode)
+	// reason-phrase = *( HTAB / SP / VCHAR / obs-text ), RFC 9112 section 4
+	for _, c := range []byte(reason) {
+		if (c < ' ' && c != '\t') || c == 0x7f {
+			return fmt.Errorf("invalid reason phrase %q: control characters are not allowed", reason)
+		}
 	}
-	statusLine = append(statusLine, crlf...)
-	_, err := w.Write(statusLine)
+
+	statusLine := fmt.Sprintf("HTTP/%s %d %s%s", httpVersion, statusCode, reason, crlf)
+	_, err := w.Write([]byte(statusLine))
 
 	return err
 }
 
-func GetDefaultHeaders(contentLen int) headers.Headers {
-	header := make(headers.Headers)
+func GetDefaultHeaders(contentLen int) *headers.Headers {
+	header := headers.NewHeaders()
 
 	header.Add("Content-Length", fmt.Sprintf("%d", contentLen))
 
-	header.Add("Connection", "close")
-
 	header.Add("Content-Type", "text/plain")
 
 	return header
 }
 
-func WriteHeader(w io.Writer, headers headers.Headers) error {
-	headerStr := strings.Join([]string{
-		headers["Content-Length"],
-		headers["Connection"],
-		headers["Content-Type"],
-	}, crlf)
+// WriteStatus writes a complete plain text response with the status text
+// as its body, e.g. for errors. Fields in extra are added to the default
+// headers, replacing any with the same name. Write errors are logged,
+// since the connection is beyond saving by then.
+func WriteStatus(w *Writer, statusCode StatusCode, extra *headers.Headers) {
+	body := []byte(StatusText(statusCode) + "\n")
 
-	_, err := w.Write([]byte(headerStr))
+	if err := w.WriteStatusLine(statusCode); err != nil {
+		log.Printf("Error writing status line: %v", err)
+		return
+	}
+
+	h := GetDefaultHeaders(len(body))
+	for key := range extra.All() {
+		h.Delete(key)
+	}
+	for key, value := range extra.All() {
+		h.Add(key, value)
+	}
+
+	if err := w.WriteHeaders(h); err != nil {
+		log.Printf("Error writing headers: %v", err)
+		return
+	}
+
+	if _, err := w.WriteBody(body); err != nil {
+		log.Printf("Error writing body: %v", err)
+	}
+}
+
+// WriteHeader writes every field line as a "Name: value" line, ordered
+// alphabetically by name and otherwise in the order they were added, e.g.
+// for repeated Set-Cookie fields. The blank line that ends the header
+// section follows.
+func WriteHeader(w io.Writer, h *headers.Headers) error {
+	type field struct{ name, value string }
+
+	fields := make([]field, 0, h.Len())
+	for name, value := range h.All() {
+		fields = append(fields, field{strings.ToLower(name), value})
+	}
+	sort.SliceStable(fields, func(i, j int) bool { return fields[i].name < fields[j].name })
+
+	var b strings.Builder
+	for _, f := range fields {
+		if strings.ContainsAny(f.value, crlf) {
+			return fmt.Errorf("invalid header value for %s: line breaks are not allowed", f.name)
+		}
+		b.WriteString(headers.CanonicalKey(f.name))
+		b.WriteString(": ")
+		b.WriteString(f.value)
+		b.WriteString(crlf)
+	}
+	b.WriteString(crlf)
+
+	_, err := w.Write([]byte(b.String()))
 
 	if err != nil {
 		return fmt.Errorf("unable to write headers to response: %w", err)
@@ -65,3 +120,283 @@ func WriteHeader(w io.Writer, headers headers.Headers) error {
 
 	return nil
 }
+
+type writerState int
+
+const (
+	writerStateStatusLine writerState = iota
+	writerStateHeaders
+	writerStateBody
+	writerStateTrailers
+	writerStateDone
+)
+
+func (s writerState) String() string {
+	switch s {
+	case writerStateStatusLine:
+		return "status line"
+	case writerStateHeaders:
+		return "headers"
+	case writerStateBody:
+		return "body"
+	case writerStateTrailers:
+		return "trailers"
+	case writerStateDone:
+		return "done"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(s))
+	}
+}
+
+// ErrWriterState is returned when a response part is written out of order
+var ErrWriterState = errors.New("invalid response writer state")
+
+// Writer writes an HTTP response to the underlying connection, enforcing
+// the status line -> headers -> body order
+type Writer struct {
+	writer        io.Writer
+	state         writerState
+	contentLength int
+	bodyWritten   int
+	chunked       bool
+	trailers      map[string]bool
+	statusCode    StatusCode
+	keepAlive     bool
+	httpVersion   string
+	// HTTP/1.0 clients do not understand chunked framing, so chunks are
+	// written as-is and the end of the body is marked by closing the connection
+	unchunked bool
+	// Called with the headers right before they are written
+	beforeHeaders []func(h *headers.Headers)
+	// The response to a HEAD request has headers but no body
+	omitBody bool
+}
+
+// NewWriter returns a writer for a response after which the connection is
+// closed, unless SetKeepAlive allows it to be reused
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{
+		writer:        w,
+		state:         writerStateStatusLine,
+		contentLength: -1,
+		httpVersion:   "1.1",
+	}
+}
+
+// SetHttpVersion sets the protocol version of the status line, matching
+// the version of the request. It must be called before the status line is written.
+func (w *Writer) SetHttpVersion(httpVersion string) {
+	w.httpVersion = httpVersion
+}
+
+// SetKeepAlive sets whether the connection may be reused after this
+// response. It must be called before the headers are written.
+func (w *Writer) SetKeepAlive(keepAlive bool) {
+	w.keepAlive = keepAlive
+}
+
+// SetOmitBody makes the writer discard the body while still checking and
+// counting it, for responses to HEAD requests which carry the headers of
+// the equivalent GET response without its body
+func (w *Writer) SetOmitBody(omitBody bool) {
+	w.omitBody = omitBody
+}
+
+// KeepAlive reports whether the connection can be reused once the response is finished
+func (w *Writer) KeepAlive() bool {
+	return w.keepAlive
+}
+
+// Written reports whether any part of the response, starting with the status line, was written
+func (w *Writer) Written() bool {
+	return w.state != writerStateStatusLine
+}
+
+// StatusCode returns the status code written so far, or 0 before the status line
+func (w *Writer) StatusCode() StatusCode {
+	return w.statusCode
+}
+
+// BytesWritten returns the number of body bytes written so far, not
+// counting chunked framing
+func (w *Writer) BytesWritten() int {
+	return w.bodyWritten
+}
+
+// Wrap replaces the destination of the response with the result of f
+// applied to it, e.g. to count or copy the raw bytes sent to the client
+func (w *Writer) Wrap(f func(io.Writer) io.Writer) {
+	w.writer = f(w.writer)
+}
+
+// BeforeWriteHeaders registers f to be called with the headers right
+// before they are written, e.g. for middleware to add headers once the
+// handler is done deciding on them. Functions are called in the order
+// they were registered.
+func (w *Writer) BeforeWriteHeaders(f func(h *headers.Headers)) {
+	w.beforeHeaders = append(w.beforeHeaders, f)
+}
+
+// WriteStatusLine writes the status line for the given status code
+func (w *Writer) WriteStatusLine(statusCode StatusCode) error {
+	return w.WriteStatusLineWithReason(statusCode, StatusText(statusCode))
+}
+
+// WriteStatusLineWithReason writes the status line for any 3-digit status
+// code with a custom reason phrase
+func (w *Writer) WriteStatusLineWithReason(statusCode StatusCode, reason string) error {
+	if w.state != writerStateStatusLine {
+		return fmt.Errorf("%w: cannot write status line while writing %s", ErrWriterState, w.state)
+	}
+
+	if err := writeStatusLine(w.writer, w.httpVersion, statusCode, reason); err != nil {
+		return err
+	}
+
+	w.statusCode = statusCode
+	w.state = writerStateHeaders
+	return nil
+}
+
+// WriteHeaders writes the header section of the response. Defaults from
+// GetDefaultHeaders are filled in for any header the caller did not set,
+// except Content-Length which only the caller can know. Connection: close
+// is added when the connection will not be reused, including when the
+// body has no Content-Length or chunked framing.
+func (w *Writer) WriteHeaders(h *headers.Headers) error {
+	if w.state != writerStateHeaders {
+		return fmt.Errorf("%w: cannot write headers while writing %s", ErrWriterState, w.state)
+	}
+
+	if h == nil {
+		h = headers.NewHeaders()
+	}
+
+	for _, f := range w.beforeHeaders {
+		f(h)
+	}
+
+	// A 304 response describes the client's cached representation, so defaults would overwrite its metadata
+	for key, value := range GetDefaultHeaders(0).All() {
+		if w.statusCode == StatusNotModified {
+			break
+		}
+		if !strings.EqualFold(key, "content-length") && !h.Has(key) {
+			h.Set(key, value)
+		}
+	}
+
+	if h.Has("content-length") {
+		contentLength, err := strconv.Atoi(h.Get("content-length"))
+		if err != nil || contentLength < 0 {
+			return fmt.Errorf("invalid Content-Length header: %q", h.Get("content-length"))
+		}
+		w.contentLength = contentLength
+	}
+
+	if strings.EqualFold(strings.TrimSpace(h.Get("transfer-encoding")), "chunked") {
+		if h.Has("content-length") {
+			return fmt.Errorf("invalid headers: Content-Length not allowed with chunked Transfer-Encoding")
+		}
+		w.chunked = true
+		w.trailers = parseTrailerNames(h.Get("trailer"))
+
+		if w.httpVersion == "1.0" {
+			h.Delete("Transfer-Encoding")
+			h.Delete("Trailer")
+			w.trailers = nil
+			w.unchunked = true
+			w.keepAlive = false
+		}
+	}
+
+	// Without framing the client can only find the end of the body when the connection closes
+	if !w.chunked && w.contentLength < 0 && bodyAllowed(w.statusCode) && !w.omitBody {
+		w.keepAlive = false
+	}
+
+	if h.HasToken("connection", "close") {
+		w.keepAlive = false
+	}
+
+	if !w.keepAlive {
+		h.Set("Connection", "close")
+	} else if w.httpVersion == "1.0" {
+		h.Set("Connection", "keep-alive")
+	}
+
+	if err := WriteHeader(w.writer, h); err != nil {
+		return err
+	}
+
+	w.state = writerStateBody
+	return nil
+}
+
+// WriteBody writes part of the response body. Writes beyond the declared
+// Content-Length are rejected.
+func (w *Writer) WriteBody(p []byte) (int, error) {
+	if w.state != writerStateBody {
+		return 0, fmt.Errorf("%w: cannot write body while writing %s", ErrWriterState, w.state)
+	}
+
+	if w.chunked {
+		return 0, fmt.Errorf("%w: use WriteChunkedBody for chunked responses", ErrWriterState)
+	}
+
+	if w.contentLength >= 0 && w.bodyWritten+len(p) > w.contentLength {
+		return 0, fmt.Errorf("body length exceeds Content-Length header: %d > %d", w.bodyWritten+len(p), w.contentLength)
+	}
+
+	if w.omitBody {
+		w.bodyWritten += len(p)
+		return len(p), nil
+	}
+
+	n, err := w.writer.Write(p)
+	w.bodyWritten += n
+
+	return n, err
+}
+
+// Finish completes whatever part of the response the handler left
+// unwritten: an empty 200 response if nothing was written, the missing
+// header section, or the end of a chunked body. A body shorter than its
+// Content-Length cannot be completed, so the connection is marked for closing.
+func (w *Writer) Finish() error {
+	switch w.state {
+	case writerStateStatusLine:
+		if err := w.WriteStatusLine(StatusSuccess); err != nil {
+			return err
+		}
+		fallthrough
+	case writerStateHeaders:
+		h := GetDefaultHeaders(0)
+		if !bodyAllowed(w.statusCode) {
+			h.Delete("Content-Length")
+		}
+		if err := w.WriteHeaders(h); err != nil {
+			return err
+		}
+	case writerStateBody:
+		if w.chunked {
+			if _, err := w.WriteChunkedBodyDone(); err != nil {
+				return err
+			}
+			return w.Finish()
+		}
+		if w.contentLength >= 0 && w.bodyWritten < w.contentLength && !w.omitBody {
+			w.keepAlive = false
+		}
+	case writerStateTrailers:
+		return w.WriteTrailers(headers.NewHeaders())
+	}
+
+	w.state = writerStateDone
+	return nil
+}
+
+// Reports whether a response with the given status code may carry a body (RFC 9110 section 6.4.1)
+func bodyAllowed(statusCode StatusCode) bool {
+	return statusCode >= 200 && statusCode != 204 && statusCode != 304
+}
@@ -0,0 +1,429 @@
+package response
+
+import (
+	"bytes"
+	"http-server/internal/headers"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Writer State Tests
+func TestWriter_FullResponseInOrder(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+
+	require.NoError(t, w.WriteStatusLine(StatusSuccess))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(5)))
+	n, err := w.WriteBody([]byte("hello"))
+	require.NoError(t, err)
+	assert.Equal(t, 5, n)
+	assert.Contains(t, buf.String(), "HTTP/1.1 200 OK\r\n")
+}
+
+func TestWriter_StatusLineTwice(t *testing.T) {
+	w := NewWriter(&bytes.Buffer{})
+
+	require.NoError(t, w.WriteStatusLine(StatusSuccess))
+	err := w.WriteStatusLine(StatusSuccess)
+	require.ErrorIs(t, err, ErrWriterState)
+}
+
+func TestWriter_HeadersBeforeStatusLine(t *testing.T) {
+	w := NewWriter(&bytes.Buffer{})
+
+	err := w.WriteHeaders(GetDefaultHeaders(0))
+	require.ErrorIs(t, err, ErrWriterState)
+}
+
+func TestWriter_BodyBeforeHeaders(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+
+	_, err := w.WriteBody([]byte("hello"))
+	require.ErrorIs(t, err, ErrWriterState)
+
+	require.NoError(t, w.WriteStatusLine(StatusSuccess))
+	_, err = w.WriteBody([]byte("hello"))
+	require.ErrorIs(t, err, ErrWriterState)
+	assert.NotContains(t, buf.String(), "hello")
+}
+
+func TestWriter_BodyExceedsContentLength(t *testing.T) {
+	w := NewWriter(&bytes.Buffer{})
+
+	require.NoError(t, w.WriteStatusLine(StatusSuccess))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(3)))
+	_, err := w.WriteBody([]byte("hello"))
+	require.Error(t, err)
+}
+
+func TestWriter_HeadersFilledFromDefaults(t *testing.T) {
+	w := NewWriter(&bytes.Buffer{})
+	h := headers.NewHeaders()
+
+	require.NoError(t, w.WriteStatusLine(StatusSuccess))
+	require.NoError(t, w.WriteHeaders(h))
+	assert.Equal(t, "text/plain", h.Get("Content-Type"))
+	assert.Equal(t, "close", h.Get("Connection"))
+	assert.False(t, h.Has("Content-Length"))
+}
+
+func TestWriteStatus(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+
+	extra := headers.NewHeaders()
+	extra.Set("Content-Type", "text/plain; charset=utf-8")
+	extra.Add("Set-Cookie", "a=1")
+	extra.Add("Set-Cookie", "b=2")
+	WriteStatus(w, StatusNotFound, extra)
+	require.NoError(t, w.Finish())
+
+	assert.Equal(t, "HTTP/1.1 404 Not Found\r\nConnection: close\r\nContent-Length: 10\r\n"+
+		"Content-Type: text/plain; charset=utf-8\r\nSet-Cookie: a=1\r\nSet-Cookie: b=2\r\n\r\nNot Found\n", buf.String())
+}
+
+// Header Serialization Tests
+func TestWriteHeader_AllHeadersSortedAndTerminated(t *testing.T) {
+	buf := &bytes.Buffer{}
+	h := headers.NewHeaders()
+	h.Set("location", "/login")
+	h.Set("Cache-Control", "no-store")
+	h.Set("content-length", "0")
+
+	require.NoError(t, WriteHeader(buf, h))
+	assert.Equal(t, "Cache-Control: no-store\r\nContent-Length: 0\r\nLocation: /login\r\n\r\n", buf.String())
+}
+
+func TestWriteHeader_RepeatedFields(t *testing.T) {
+	h := headers.NewHeaders()
+	h.Add("set-cookie", "b=2; Expires=Wed, 21 Oct 2026 07:28:00 GMT")
+	h.Add("Content-Length", "0")
+	h.Add("Set-Cookie", "a=1")
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, WriteHeader(buf, h))
+	assert.Equal(t, "Content-Length: 0\r\nSet-Cookie: b=2; Expires=Wed, 21 Oct 2026 07:28:00 GMT\r\nSet-Cookie: a=1\r\n\r\n", buf.String())
+}
+
+func TestWriteHeader_Empty(t *testing.T) {
+	buf := &bytes.Buffer{}
+
+	require.NoError(t, WriteHeader(buf, headers.NewHeaders()))
+	assert.Equal(t, "\r\n", buf.String())
+}
+
+func TestWriteHeader_RejectsLineBreaksInValue(t *testing.T) {
+	buf := &bytes.Buffer{}
+	h := headers.NewHeaders()
+	h.Set("Location", "/\r\nSet-Cookie: evil=1")
+
+	require.Error(t, WriteHeader(buf, h))
+	assert.Empty(t, buf.String())
+}
+
+// Chunked Body Tests
+func chunkedHeaders(trailer string) *headers.Headers {
+	h := headers.NewHeaders()
+	h.Set("Transfer-Encoding", "chunked")
+	if trailer != "" {
+		h.Set("Trailer", trailer)
+	}
+	return h
+}
+
+func TestWriter_ChunkedBody(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+
+	require.NoError(t, w.WriteStatusLine(StatusSuccess))
+	require.NoError(t, w.WriteHeaders(chunkedHeaders("")))
+	buf.Reset()
+
+	_, err := w.WriteChunkedBody([]byte("hello world!"))
+	require.NoError(t, err)
+	_, err = w.WriteChunkedBody(nil)
+	require.NoError(t, err)
+	_, err = w.WriteChunkedBodyDone()
+	require.NoError(t, err)
+	assert.Equal(t, "c\r\nhello world!\r\n0\r\n\r\n", buf.String())
+
+	_, err = w.WriteChunkedBody([]byte("late"))
+	require.ErrorIs(t, err, ErrWriterState)
+}
+
+func TestWriter_ChunkedBodyWithTrailers(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+
+	require.NoError(t, w.WriteStatusLine(StatusSuccess))
+	require.NoError(t, w.WriteHeaders(chunkedHeaders("X-Content-Length")))
+	buf.Reset()
+
+	_, err := w.WriteChunkedBody([]byte("hello"))
+	require.NoError(t, err)
+	_, err = w.WriteChunkedBodyDone()
+	require.NoError(t, err)
+
+	trailers := headers.NewHeaders()
+	trailers.Set("X-Content-Length", "5")
+	require.NoError(t, w.WriteTrailers(trailers))
+	assert.Equal(t, "5\r\nhello\r\n0\r\nX-Content-Length: 5\r\n\r\n", buf.String())
+}
+
+func TestWriter_UndeclaredTrailer(t *testing.T) {
+	w := NewWriter(&bytes.Buffer{})
+
+	require.NoError(t, w.WriteStatusLine(StatusSuccess))
+	require.NoError(t, w.WriteHeaders(chunkedHeaders("X-Content-Length")))
+	_, err := w.WriteChunkedBodyDone()
+	require.NoError(t, err)
+
+	trailers := headers.NewHeaders()
+	trailers.Set("X-Other", "1")
+	require.Error(t, w.WriteTrailers(trailers))
+}
+
+func TestWriter_ChunkedBodyWithoutHeader(t *testing.T) {
+	w := NewWriter(&bytes.Buffer{})
+
+	require.NoError(t, w.WriteStatusLine(StatusSuccess))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(5)))
+	_, err := w.WriteChunkedBody([]byte("hello"))
+	require.ErrorIs(t, err, ErrWriterState)
+}
+
+// Connection Persistence Tests
+func TestWriter_KeepAliveWithContentLength(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	w.SetKeepAlive(true)
+
+	require.NoError(t, w.WriteStatusLine(StatusSuccess))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(0)))
+	assert.True(t, w.KeepAlive())
+	assert.NotContains(t, buf.String(), "Connection")
+}
+
+func TestWriter_KeepAliveWithoutFraming(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	w.SetKeepAlive(true)
+
+	require.NoError(t, w.WriteStatusLine(StatusSuccess))
+	require.NoError(t, w.WriteHeaders(headers.NewHeaders()))
+	assert.False(t, w.KeepAlive())
+	assert.Contains(t, buf.String(), "Connection: close\r\n")
+}
+
+func TestWriter_HandlerRequestsClose(t *testing.T) {
+	w := NewWriter(&bytes.Buffer{})
+	w.SetKeepAlive(true)
+	h := GetDefaultHeaders(0)
+	h.Set("Connection", "close")
+
+	require.NoError(t, w.WriteStatusLine(StatusSuccess))
+	require.NoError(t, w.WriteHeaders(h))
+	assert.False(t, w.KeepAlive())
+}
+
+func TestWriter_FinishEmptyResponse(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	w.SetKeepAlive(true)
+
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 0\r\nContent-Type: text/plain\r\n\r\n", buf.String())
+	assert.True(t, w.KeepAlive())
+}
+
+func TestWriter_FinishChunkedBody(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	w.SetKeepAlive(true)
+
+	require.NoError(t, w.WriteStatusLine(StatusSuccess))
+	require.NoError(t, w.WriteHeaders(chunkedHeaders("X-Content-Length")))
+	buf.Reset()
+
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "0\r\n\r\n", buf.String())
+	assert.True(t, w.KeepAlive())
+}
+
+func TestWriter_FinishShortBody(t *testing.T) {
+	w := NewWriter(&bytes.Buffer{})
+	w.SetKeepAlive(true)
+
+	require.NoError(t, w.WriteStatusLine(StatusSuccess))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(10)))
+	_, err := w.WriteBody([]byte("short"))
+	require.NoError(t, err)
+
+	require.NoError(t, w.Finish())
+	assert.False(t, w.KeepAlive())
+}
+
+// Observation Tests
+func TestWriter_StatusCodeAndBytesWritten(t *testing.T) {
+	w := NewWriter(&bytes.Buffer{})
+	assert.Equal(t, StatusCode(0), w.StatusCode())
+
+	require.NoError(t, w.WriteStatusLine(StatusCreated))
+	require.NoError(t, w.WriteHeaders(chunkedHeaders("X-Content-Length")))
+	_, err := w.WriteChunkedBody([]byte("hello"))
+	require.NoError(t, err)
+	_, err = w.WriteChunkedBody([]byte(" world"))
+	require.NoError(t, err)
+
+	assert.Equal(t, StatusCreated, w.StatusCode())
+	assert.Equal(t, 11, w.BytesWritten())
+}
+
+func TestWriter_Wrap(t *testing.T) {
+	buf := &bytes.Buffer{}
+	copied := &bytes.Buffer{}
+	w := NewWriter(buf)
+	w.Wrap(func(dst io.Writer) io.Writer { return io.MultiWriter(dst, copied) })
+
+	require.NoError(t, w.WriteStatusLine(StatusSuccess))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(5)))
+	_, err := w.WriteBody([]byte("hello"))
+	require.NoError(t, err)
+
+	assert.Equal(t, buf.String(), copied.String())
+	assert.Contains(t, copied.String(), "HTTP/1.1 200 OK\r\n")
+}
+
+func TestWriter_BeforeWriteHeaders(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+
+	var calls []string
+	w.BeforeWriteHeaders(func(h *headers.Headers) {
+		calls = append(calls, "first")
+		h.Set("X-Request-Id", "42")
+	})
+	w.BeforeWriteHeaders(func(h *headers.Headers) {
+		calls = append(calls, "second")
+		assert.Equal(t, "42", h.Get("X-Request-Id"))
+	})
+
+	require.NoError(t, w.Finish())
+	assert.Equal(t, []string{"first", "second"}, calls)
+	assert.Contains(t, buf.String(), "X-Request-Id: 42\r\n")
+}
+
+// HEAD Response Tests
+func TestWriter_OmitBody(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	w.SetOmitBody(true)
+	w.SetKeepAlive(true)
+
+	require.NoError(t, w.WriteStatusLine(StatusSuccess))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(5)))
+	n, err := w.WriteBody([]byte("hello"))
+	require.NoError(t, err)
+	assert.Equal(t, 5, n)
+	require.NoError(t, w.Finish())
+
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 5\r\nContent-Type: text/plain\r\n\r\n", buf.String())
+	assert.Equal(t, 5, w.BytesWritten())
+	assert.True(t, w.KeepAlive())
+}
+
+func TestWriter_OmitChunkedBody(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	w.SetOmitBody(true)
+	w.SetKeepAlive(true)
+
+	require.NoError(t, w.WriteStatusLine(StatusSuccess))
+	require.NoError(t, w.WriteHeaders(chunkedHeaders("X-Content-Length")))
+	buf.Reset()
+
+	_, err := w.WriteChunkedBody([]byte("hello"))
+	require.NoError(t, err)
+	_, err = w.WriteChunkedBodyDone()
+	require.NoError(t, err)
+	require.NoError(t, w.WriteTrailers(headers.NewHeaders()))
+	require.NoError(t, w.Finish())
+
+	assert.Empty(t, buf.String())
+	assert.True(t, w.KeepAlive())
+}
+
+// HTTP/1.0 Tests
+func TestWriter_HTTP10StatusLine(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	w.SetHttpVersion("1.0")
+	w.SetKeepAlive(true)
+
+	require.NoError(t, w.WriteStatusLine(StatusSuccess))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(0)))
+	assert.Equal(t, "HTTP/1.0 200 OK\r\nConnection: keep-alive\r\nContent-Length: 0\r\nContent-Type: text/plain\r\n\r\n", buf.String())
+}
+
+func TestWriter_HTTP10ChunkedBodyWrittenAsIs(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	w.SetHttpVersion("1.0")
+	w.SetKeepAlive(true)
+
+	require.NoError(t, w.WriteStatusLine(StatusSuccess))
+	require.NoError(t, w.WriteHeaders(chunkedHeaders("X-Content-Length")))
+	_, err := w.WriteChunkedBody([]byte("hello"))
+	require.NoError(t, err)
+	_, err = w.WriteChunkedBodyDone()
+	require.NoError(t, err)
+	require.NoError(t, w.WriteTrailers(headers.NewHeaders()))
+
+	assert.Equal(t, "HTTP/1.0 200 OK\r\nConnection: close\r\nContent-Type: text/plain\r\n\r\nhello", buf.String())
+	assert.False(t, w.KeepAlive())
+}
+
+// Status Line Tests
+func TestWriteStatusLine_RegisteredCodes(t *testing.T) {
+	testCases := map[StatusCode]string{
+		StatusCreated:            "HTTP/1.1 201 Created\r\n",
+		StatusNoContent:          "HTTP/1.1 204 No Content\r\n",
+		StatusMovedPermanently:   "HTTP/1.1 301 Moved Permanently\r\n",
+		StatusNotModified:        "HTTP/1.1 304 Not Modified\r\n",
+		StatusMethodNotAllowed:   "HTTP/1.1 405 Method Not Allowed\r\n",
+		StatusTooManyRequests:    "HTTP/1.1 429 Too Many Requests\r\n",
+		StatusServiceUnavailable: "HTTP/1.1 503 Service Unavailable\r\n",
+	}
+
+	for statusCode, expected := range testCases {
+		buf := &bytes.Buffer{}
+		require.NoError(t, WriteStatusLine(buf, statusCode))
+		assert.Equal(t, expected, buf.String())
+	}
+}
+
+func TestWriteStatusLine_UnregisteredCode(t *testing.T) {
+	buf := &bytes.Buffer{}
+
+	require.NoError(t, WriteStatusLine(buf, 599))
+	assert.Equal(t, "HTTP/1.1 599 \r\n", buf.String())
+	assert.Empty(t, StatusText(599))
+}
+
+func TestWriteStatusLine_CustomReason(t *testing.T) {
+	buf := &bytes.Buffer{}
+
+	require.NoError(t, WriteStatusLineWithReason(buf, 299, "Custom Thing"))
+	assert.Equal(t, "HTTP/1.1 299 Custom Thing\r\n", buf.String())
+}
+
+func TestWriteStatusLine_InvalidCodes(t *testing.T) {
+	for _, statusCode := range []StatusCode{0, 99, 1000, -200} {
+		require.Error(t, WriteStatusLine(&bytes.Buffer{}, statusCode))
+	}
+	require.Error(t, WriteStatusLineWithReason(&bytes.Buffer{}, 200, "OK\r\nX-Injected: 1"))
+}
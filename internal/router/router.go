@@ -0,0 +1,251 @@
+package router
+
+import (
+	"fmt"
+	"http-server/internal/headers"
+	"http-server/internal/request"
+	"http-server/internal/response"
+	"http-server/internal/server"
+	"sort"
+	"strings"
+)
+
+type segmentKind int
+
+// Ordered from most to least specific, so a literal segment wins over a
+// parameter and a parameter wins over a wildcard
+const (
+	segmentLiteral segmentKind = iota
+	segmentParam
+	segmentWildcard
+)
+
+type segment struct {
+	kind  segmentKind
+	value string
+}
+
+type route struct {
+	method   string
+	pattern  string
+	segments []segment
+	handler  server.Handler
+}
+
+// Router dispatches requests to handlers by method and path pattern.
+// Patterns are made of "/" separated segments, each either a literal, a
+// parameter like {id} matching one segment, or, as the last segment, a
+// wildcard like {path...} matching the rest of the path. Captured values
+// are available from req.PathValue.
+type Router struct {
+	routes []route
+}
+
+func New() *Router {
+	return &Router{}
+}
+
+// Handle registers handler for requests with the given method whose path
+// matches pattern. It panics on invalid or duplicate patterns, since those
+// are programming errors.
+func (r *Router) Handle(method, pattern string, handler server.Handler) {
+	if handler == nil {
+		panic("router: nil handler for " + pattern)
+	}
+
+	segments, err := parsePattern(pattern)
+	if err != nil {
+		panic(fmt.Sprintf("router: %v", err))
+	}
+
+	for _, rt := range r.routes {
+		if rt.method == method && samePattern(rt.segments, segments) {
+			panic(fmt.Sprintf("router: %s %s conflicts with %s %s", method, pattern, rt.method, rt.pattern))
+		}
+	}
+
+	r.routes = append(r.routes, route{
+		method:   method,
+		pattern:  pattern,
+		segments: segments,
+		handler:  handler,
+	})
+}
+
+// ServeRequest is a server.Handler that runs the most specific route
+// matching the request's path. The path is split into segments before
+// they are decoded, so an encoded slash stays inside its segment. HEAD
+// requests without a HEAD route run the GET route, since the server drops
+// their body. Unknown paths get 404 Not Found and known paths with another
+// method get 405 Method Not Allowed with an Allow header.
+func (r *Router) ServeRequest(w *response.Writer, req *request.Request) {
+	path := req.URL.RawPath
+
+	var best, get *route
+	var bestValues, getValues map[string]string
+	allowed := make(map[string]bool)
+
+	// Only targets with a path, not "*" or CONNECT's host:port, can match a route
+	for i := 0; strings.HasPrefix(path, "/") && i < len(r.routes); i++ {
+		rt := &r.routes[i]
+		values, ok := match(rt.segments, path)
+		if !ok {
+			continue
+		}
+
+		allowed[rt.method] = true
+		if rt.method == "GET" {
+			allowed["HEAD"] = true
+			if get == nil || moreSpecific(rt.segments, get.segments) {
+				get, getValues = rt, values
+			}
+		}
+		if rt.method != req.RequestLine.Method {
+			continue
+		}
+
+		if best == nil || moreSpecific(rt.segments, best.segments) {
+			best, bestValues = rt, values
+		}
+	}
+
+	if best == nil && req.RequestLine.Method == "HEAD" {
+		best, bestValues = get, getValues
+	}
+
+	if best == nil {
+		if len(allowed) == 0 {
+			response.WriteStatus(w, response.StatusNotFound, nil)
+			return
+		}
+
+		methods := make([]string, 0, len(allowed))
+		for method := range allowed {
+			methods = append(methods, method)
+		}
+		sort.Strings(methods)
+		h := headers.NewHeaders()
+		h.Set("Allow", strings.Join(methods, ", "))
+		response.WriteStatus(w, response.StatusMethodNotAllowed, h)
+		return
+	}
+
+	for name, value := range bestValues {
+		req.SetPathValue(name, value)
+	}
+	best.handler(w, req)
+}
+
+func parsePattern(pattern string) ([]segment, error) {
+	if !strings.HasPrefix(pattern, "/") {
+		return nil, fmt.Errorf("pattern %q must start with /", pattern)
+	}
+
+	parts := strings.Split(pattern[1:], "/")
+	segments := make([]segment, 0, len(parts))
+	names := make(map[string]bool)
+
+	for i, part := range parts {
+		if !strings.HasPrefix(part, "{") || !strings.HasSuffix(part, "}") {
+			if strings.ContainsAny(part, "{}") {
+				return nil, fmt.Errorf("pattern %q: segment %q mixes literal text and a parameter", pattern, part)
+			}
+			segments = append(segments, segment{kind: segmentLiteral, value: part})
+			continue
+		}
+
+		name := part[1 : len(part)-1]
+		kind := segmentParam
+		if strings.HasSuffix(name, "...") {
+			if i != len(parts)-1 {
+				return nil, fmt.Errorf("pattern %q: wildcard %q must be the last segment", pattern, part)
+			}
+			name = strings.TrimSuffix(name, "...")
+			kind = segmentWildcard
+		}
+
+		if name == "" || strings.ContainsAny(name, "{}.") {
+			return nil, fmt.Errorf("pattern %q: invalid parameter name in %q", pattern, part)
+		}
+		if names[name] {
+			return nil, fmt.Errorf("pattern %q: duplicate parameter %q", pattern, name)
+		}
+		names[name] = true
+
+		segments = append(segments, segment{kind: kind, value: name})
+	}
+
+	return segments, nil
+}
+
+// Matches the raw, percent-encoded path against the pattern segments,
+// returning the decoded captured values
+func match(segments []segment, rawPath string) (map[string]string, bool) {
+	parts := strings.Split(strings.TrimPrefix(rawPath, "/"), "/")
+	values := make(map[string]string)
+
+	for i, seg := range segments {
+		if i >= len(parts) {
+			return nil, false
+		}
+
+		// A wildcard captures the decoded rest of the path, where "%2F" and "/" look alike
+		raw := parts[i]
+		if seg.kind == segmentWildcard {
+			raw = strings.Join(parts[i:], "/")
+		}
+		part, err := request.PathUnescape(raw)
+		if err != nil {
+			return nil, false
+		}
+
+		switch seg.kind {
+		case segmentWildcard:
+			values[seg.value] = part
+			return values, true
+		case segmentLiteral:
+			if part != seg.value {
+				return nil, false
+			}
+		case segmentParam:
+			if part == "" {
+				return nil, false
+			}
+			values[seg.value] = part
+		}
+	}
+
+	if len(parts) != len(segments) {
+		return nil, false
+	}
+
+	return values, true
+}
+
+// Reports whether a is more specific than b, comparing segment kinds from left to right
+func moreSpecific(a, b []segment) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i].kind != b[i].kind {
+			return a[i].kind < b[i].kind
+		}
+	}
+	return len(a) > len(b)
+}
+
+// Reports whether two patterns match exactly the same paths
+func samePattern(a, b []segment) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i].kind != b[i].kind {
+			return false
+		}
+		if a[i].kind == segmentLiteral && a[i].value != b[i].value {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,160 @@
+package router
+
+import (
+	"bytes"
+	"http-server/internal/request"
+	"http-server/internal/response"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serve runs a raw request through the router and returns the raw response
+func serve(t *testing.T, r *Router, raw string) string {
+	t.Helper()
+
+	req, err := request.RequestFromReader(strings.NewReader(raw))
+	require.NoError(t, err)
+
+	buf := &bytes.Buffer{}
+	w := response.NewWriter(buf)
+	r.ServeRequest(w, req)
+	require.NoError(t, w.Finish())
+
+	return buf.String()
+}
+
+// echo responds with the route name and the captured path values
+func echo(name string, params ...string) func(w *response.Writer, req *request.Request) {
+	return func(w *response.Writer, req *request.Request) {
+		body := name
+		for _, param := range params {
+			body += " " + param + "=" + req.PathValue(param)
+		}
+		w.WriteStatusLine(response.StatusSuccess)
+		w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+		w.WriteBody([]byte(body))
+	}
+}
+
+func get(target string) string {
+	return "GET " + target + " HTTP/1.1\r\nHost: localhost\r\n\r\n"
+}
+
+// Matching Tests
+func TestRouter_Matching(t *testing.T) {
+	r := New()
+	r.Handle("GET", "/", echo("root"))
+	r.Handle("GET", "/users", echo("users"))
+	r.Handle("GET", "/users/{id}", echo("user", "id"))
+	r.Handle("GET", "/users/me", echo("me"))
+	r.Handle("GET", "/users/{id}/posts/{post}", echo("post", "id", "post"))
+	r.Handle("GET", "/static/{path...}", echo("static", "path"))
+
+	testCases := []struct {
+		target   string
+		expected string
+	}{
+		{target: "/", expected: "root"},
+		{target: "/users", expected: "users"},
+		{target: "/users?sort=name", expected: "users"},
+		{target: "/users/42", expected: "user id=42"},
+		{target: "/users/a%20b", expected: "user id=a b"},
+		{target: "/users/a%2Fb", expected: "user id=a/b"},
+		{target: "/users/m%65", expected: "me"},
+		{target: "/users/a%2Fb/posts/7", expected: "post id=a/b post=7"},
+		{target: "/static/a%20b/c%2Fd.css", expected: "static path=a b/c/d.css"},
+		{target: "/users/me", expected: "me"},
+		{target: "/users/42/posts/7", expected: "post id=42 post=7"},
+		{target: "/static/css/site.css", expected: "static path=css/site.css"},
+		{target: "/static/", expected: "static path="},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.target, func(t *testing.T) {
+			out := serve(t, r, get(tc.target))
+			assert.True(t, strings.HasPrefix(out, "HTTP/1.1 200 OK\r\n"), out)
+			assert.True(t, strings.HasSuffix(out, "\r\n\r\n"+tc.expected), out)
+		})
+	}
+}
+
+func TestRouter_NotFound(t *testing.T) {
+	r := New()
+	r.Handle("GET", "/users/{id}", echo("user", "id"))
+	r.Handle("GET", "/static/{path...}", echo("static", "path"))
+
+	for _, target := range []string{"/missing", "/users", "/users/", "/users/42/extra", "/static"} {
+		out := serve(t, r, get(target))
+		assert.True(t, strings.HasPrefix(out, "HTTP/1.1 404 Not Found\r\n"), target)
+	}
+
+	for _, line := range []string{"OPTIONS *", "CONNECT localhost:443"} {
+		out := serve(t, r, line+" HTTP/1.1\r\nHost: localhost\r\n\r\n")
+		assert.True(t, strings.HasPrefix(out, "HTTP/1.1 404 Not Found\r\n"), line)
+	}
+}
+
+func TestRouter_MethodNotAllowed(t *testing.T) {
+	r := New()
+	r.Handle("GET", "/users/{id}", echo("get"))
+	r.Handle("DELETE", "/users/{id}", echo("delete"))
+	r.Handle("PUT", "/users/me", echo("put"))
+
+	out := serve(t, r, "POST /users/42 HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 405 Method Not Allowed\r\n"), out)
+	assert.Contains(t, out, "Allow: DELETE, GET, HEAD\r\n")
+
+	out = serve(t, r, "POST /users/me HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.Contains(t, out, "Allow: DELETE, GET, HEAD, PUT\r\n")
+
+	out = serve(t, r, "DELETE /users/42 HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.True(t, strings.HasSuffix(out, "delete"), out)
+}
+
+func TestRouter_HeadFallsBackToGet(t *testing.T) {
+	r := New()
+	r.Handle("GET", "/users/{id}", echo("get", "id"))
+	r.Handle("GET", "/users/me", echo("me"))
+	r.Handle("HEAD", "/static/{path...}", echo("head"))
+	r.Handle("GET", "/static/{path...}", echo("get"))
+	r.Handle("PUT", "/items/{id}", echo("put"))
+
+	out := serve(t, r, "HEAD /users/42 HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.True(t, strings.HasSuffix(out, "get id=42"), out)
+
+	out = serve(t, r, "HEAD /users/me HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.True(t, strings.HasSuffix(out, "me"), out)
+
+	out = serve(t, r, "HEAD /static/a.css HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.True(t, strings.HasSuffix(out, "head"), out)
+
+	out = serve(t, r, "HEAD /items/1 HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 405 Method Not Allowed\r\n"), out)
+	assert.Contains(t, out, "Allow: PUT\r\n")
+}
+
+// Pattern Tests
+func TestRouter_InvalidPatterns(t *testing.T) {
+	for _, pattern := range []string{
+		"users",
+		"/users/{}",
+		"/users/{id",
+		"/users/id}",
+		"/users/x{id}",
+		"/static/{path...}/more",
+		"/users/{id}/{id}",
+	} {
+		assert.Panics(t, func() { New().Handle("GET", pattern, echo("x")) }, pattern)
+	}
+}
+
+func TestRouter_DuplicatePatterns(t *testing.T) {
+	r := New()
+	r.Handle("GET", "/users/{id}", echo("x"))
+
+	assert.Panics(t, func() { r.Handle("GET", "/users/{name}", echo("y")) })
+	assert.NotPanics(t, func() { r.Handle("POST", "/users/{id}", echo("y")) })
+}
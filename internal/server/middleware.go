@@ -0,0 +1,14 @@
+package server
+
+// Middleware wraps a handler to run code before and after it. It may
+// short-circuit by writing a response without calling the next handler.
+type Middleware func(Handler) Handler
+
+// Chain wraps handler with middleware so that the first middleware is the
+// outermost: it runs first on the way in and last on the way out
+func Chain(handler Handler, middleware ...Middleware) Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	return handler
+}
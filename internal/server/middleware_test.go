@@ -0,0 +1,87 @@
+package server
+
+import (
+	"bytes"
+	"http-server/internal/request"
+	"http-server/internal/response"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// record returns middleware that appends its name to log before and after the next handler
+func record(name string, log *[]string) Middleware {
+	return func(next Handler) Handler {
+		return func(w *response.Writer, req *request.Request) {
+			*log = append(*log, name+" in")
+			next(w, req)
+			*log = append(*log, name+" out")
+		}
+	}
+}
+
+func TestChain_Order(t *testing.T) {
+	var log []string
+	handler := Chain(func(w *response.Writer, req *request.Request) {
+		log = append(log, "handler")
+	}, record("first", &log), record("second", &log))
+
+	handler(response.NewWriter(&bytes.Buffer{}), &request.Request{})
+
+	assert.Equal(t, []string{"first in", "second in", "handler", "second out", "first out"}, log)
+}
+
+func TestChain_NoMiddleware(t *testing.T) {
+	called := false
+	handler := Chain(func(w *response.Writer, req *request.Request) { called = true })
+
+	handler(response.NewWriter(&bytes.Buffer{}), &request.Request{})
+	assert.True(t, called)
+}
+
+func TestServer_MiddlewareShortCircuits(t *testing.T) {
+	deny := func(next Handler) Handler {
+		return func(w *response.Writer, req *request.Request) {
+			if req.Headers.Get("authorization") == "" {
+				response.WriteStatus(w, response.StatusUnauthorized, nil)
+				return
+			}
+			next(w, req)
+		}
+	}
+
+	_, conn := startServer(t, helloHandler, func(s *Server) { s.Middleware = []Middleware{deny} })
+
+	_, err := conn.Write([]byte("GET /a HTTP/1.1\r\nHost: localhost\r\n\r\n" +
+		"GET /b HTTP/1.1\r\nHost: localhost\r\nAuthorization: yes\r\nConnection: close\r\n\r\n"))
+	require.NoError(t, err)
+
+	out := readAll(t, conn)
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 401 Unauthorized\r\n"), out)
+	assert.True(t, strings.HasSuffix(out, "hello /b"), out)
+}
+
+func TestServer_MiddlewareObservesResponse(t *testing.T) {
+	type result struct {
+		status response.StatusCode
+		bytes  int
+	}
+	results := make(chan result, 1)
+
+	observe := func(next Handler) Handler {
+		return func(w *response.Writer, req *request.Request) {
+			next(w, req)
+			results <- result{w.StatusCode(), w.BytesWritten()}
+		}
+	}
+
+	_, conn := startServer(t, helloHandler, func(s *Server) { s.Middleware = []Middleware{observe} })
+
+	_, err := conn.Write([]byte("GET /abc HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n"))
+	require.NoError(t, err)
+	readAll(t, conn)
+
+	assert.Equal(t, result{response.StatusSuccess, len("hello /abc")}, <-results)
+}
@@ -1,27 +1,116 @@
 package server
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"http-server/internal/headers"
+	"http-server/internal/request"
+	"http-server/internal/response"
+	"io"
 	"log"
 	"net"
+	"runtime/debug"
+	"sync"
 	"sync/atomic"
+	"time"
+)
+
+// Handler responds to a single parsed HTTP request
+type Handler func(w *response.Writer, req *request.Request)
+
+// Option configures a Server before it starts accepting connections
+type Option func(*Server)
+
+const (
+	defaultIdleTimeout       = 2 * time.Minute
+	defaultReadHeaderTimeout = 10 * time.Second
+	readBufferSize           = 64 * 1024
+	drainTimeout             = 500 * time.Millisecond
+	maxDrainBytes            = 256 * 1024
+	shutdownPollInterval     = 50 * time.Millisecond
 )
 
 type Server struct {
+	// ReadHeaderTimeout is how long a client has to send the request line
+	// and headers, counted from the connection being accepted or, on a
+	// persistent connection, from the first byte of the request. Requests
+	// that take longer get 408 Request Timeout. Zero means ReadTimeout is used.
+	ReadHeaderTimeout time.Duration
+	// ReadTimeout is how long a client has to send a whole request,
+	// including its body. Zero means no limit.
+	ReadTimeout time.Duration
+	// WriteTimeout is how long the handler has to write the response once
+	// the request is read. Zero means no limit.
+	WriteTimeout time.Duration
+	// IdleTimeout is how long a persistent connection may wait for its next
+	// request before it is closed. Zero means no limit.
+	IdleTimeout time.Duration
+	// MaxRequestsPerConn is the number of requests served on a connection
+	// before it is closed. Zero means no limit.
+	MaxRequestsPerConn int
+	// Limits bounds the size of each request
+	Limits request.Limits
+	// StreamRequestBodies hands requests to the handler as soon as their
+	// headers are parsed. Handlers then read the body from req.BodyReader
+	// instead of req.Body.
+	StreamRequestBodies bool
+	// Middleware wraps every request's handler, the first being the outermost
+	Middleware []Middleware
+	// OnPanic is called with the recovered value and stack trace when a
+	// handler or anything else serving a connection panics, e.g. a
+	// BeforeWriteHeaders hook, to forward it to an error reporter. The
+	// panic is logged either way. req is nil when no request was parsed yet.
+	OnPanic func(req *request.Request, recovered any, stack []byte)
+
 	listener net.Listener
 	enabled  *atomic.Bool
+	handler  Handler
+
+	mu         sync.Mutex
+	conns      map[net.Conn]connState
+	onShutdown []func()
+
+	// Parent of every request context, cancelled by Close
+	baseCtx    context.Context
+	cancelBase context.CancelFunc
 }
 
-func Serve(port int) (*Server, error) {
+type connState int
+
+const (
+	// Waiting for the next request, safe to close during shutdown
+	connStateIdle connState = iota
+	// Reading a request or running its handler
+	connStateActive
+)
+
+func Serve(port int, handler Handler, opts ...Option) (*Server, error) {
+	if handler == nil {
+		return nil, fmt.Errorf("invalid handler: handler must not be nil")
+	}
+
+	s := &Server{
+		ReadHeaderTimeout: defaultReadHeaderTimeout,
+		IdleTimeout:       defaultIdleTimeout,
+		Limits:            request.DefaultLimits,
+		enabled:           &atomic.Bool{},
+		handler:           handler,
+		conns:             make(map[net.Conn]connState),
+	}
+	s.baseCtx, s.cancelBase = context.WithCancel(context.Background())
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.handler = Chain(s.handler, s.Middleware...)
+
 	l, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
 	if err != nil {
 		return nil, err
 	}
 
-	s := &Server{
-		listener: l,
-		enabled:  &atomic.Bool{},
-	}
+	s.listener = l
 	s.enabled.Store(true)
 
 	go s.listen()
@@ -39,27 +128,388 @@ func (s *Server) listen() {
 			log.Printf("Error accepting connection: %v", err)
 			continue
 		}
+
+		if !s.trackConn(conn) {
+			conn.Close()
+			return
+		}
 		go s.handle(conn)
 	}
 }
 
+// Close stops the server immediately, closing the listener and every
+// connection including those with requests in flight, and cancelling
+// their request contexts
 func (s *Server) Close() error {
-	s.enabled.Store(false)
+	err := s.stopListening()
+	s.cancelBase()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+
+	return err
+}
+
+// Shutdown stops accepting connections and closes idle ones, then waits
+// for in-flight requests to finish. Connections finishing a request are
+// closed instead of being kept alive. When ctx is done first, the
+// remaining connections are closed and ctx's error is returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	err := s.stopListening()
+
+	s.mu.Lock()
+	for _, f := range s.onShutdown {
+		go f()
+	}
+	s.mu.Unlock()
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if s.closeIdleConns() {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			s.Close()
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// RegisterOnShutdown registers f to be called in its own goroutine when
+// Shutdown starts, e.g. to notify long-lived connections to wrap up
+func (s *Server) RegisterOnShutdown(f func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onShutdown = append(s.onShutdown, f)
+}
+
+func (s *Server) stopListening() error {
+	if !s.enabled.Swap(false) {
+		return nil
+	}
 	if s.listener != nil {
 		return s.listener.Close()
 	}
 	return nil
 }
 
+// Closes every idle connection, reporting whether no connections are left
+func (s *Server) closeIdleConns() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for conn, state := range s.conns {
+		if state == connStateIdle {
+			conn.Close()
+			delete(s.conns, conn)
+		}
+	}
+
+	return len(s.conns) == 0
+}
+
+// Starts tracking a new idle connection, reporting false once the server is stopping
+func (s *Server) trackConn(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.enabled.Load() {
+		return false
+	}
+	s.conns[conn] = connStateIdle
+	return true
+}
+
+func (s *Server) untrackConn(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conns, conn)
+}
+
+// Updates the state of a tracked connection, reporting false when the
+// connection was closed by a shutdown and must not start another request
+func (s *Server) setConnState(conn net.Conn, state connState) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.conns[conn]; !ok {
+		return false
+	}
+	if state == connStateActive && !s.enabled.Load() {
+		return false
+	}
+	s.conns[conn] = state
+	return true
+}
+
+// Serves requests on conn one after another until either side asks to
+// close it. Pipelined requests are answered in the order they were sent.
 func (s *Server) handle(conn net.Conn) {
 	defer conn.Close()
-	response := "HTTP/1.1 200 OK\r\n" +
-		"Content-Type: text/plain\r\n" +
-		"\r\n" +
-		"Hello, World!"
+	defer s.untrackConn(conn)
+
+	// Code running after the handler, like the BeforeWriteHeaders hooks
+	// run by Finish, may panic too. That only closes this connection.
+	var req *request.Request
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			s.reportPanic(req, recovered)
+		}
+	}()
+
+	reader := bufio.NewReaderSize(conn, readBufferSize)
+	start := time.Now()
+
+	connCtx, cancelConn := context.WithCancel(s.baseCtx)
+	defer cancelConn()
+
+	for served := 1; ; served++ {
+		if !s.waitForRequest(conn, reader, served == 1, start) {
+			return
+		}
+		if served > 1 {
+			start = time.Now()
+		}
+
+		w := response.NewWriter(conn)
+
+		// Headers are parsed on their own so the header and whole request deadlines can differ
+		setReadDeadline(conn, start, s.headerTimeout())
+		var err error
+		req, err = request.RequestFromReader(reader, request.WithLimits(s.Limits), request.WithStreamingBody())
+		if err != nil {
+			rejectRequest(conn, w, err)
+			return
+		}
+
+		setReadDeadline(conn, start, s.ReadTimeout)
+		if !s.StreamRequestBodies {
+			if err := req.ReadBody(); err != nil {
+				rejectRequest(conn, w, err)
+				return
+			}
+		}
 
-	_, err := conn.Write([]byte(response))
+		w.SetHttpVersion(req.RequestLine.HttpVersion)
+		w.SetOmitBody(req.RequestLine.Method == "HEAD")
+
+		lastRequest := s.MaxRequestsPerConn > 0 && served >= s.MaxRequestsPerConn
+		w.SetKeepAlive(req.KeepAlive() && !lastRequest && s.enabled.Load())
+
+		if s.WriteTimeout > 0 {
+			conn.SetWriteDeadline(time.Now().Add(s.WriteTimeout))
+		}
+
+		ctx, cancel := s.requestContext(connCtx)
+		req = req.WithContext(ctx)
+
+		// A streamed body is still read from the connection by the handler,
+		// so disconnects can only be watched for when it was read up front
+		stopWatching := func() {}
+		if !s.StreamRequestBodies {
+			stopWatching = watchConn(conn, reader, cancel)
+		}
+
+		panicked := s.runHandler(w, req)
+		stopWatching()
+		cancel()
+
+		if err := req.RemoveMultipartFiles(); err != nil {
+			log.Printf("Error removing multipart files: %v", err)
+		}
+
+		// The handler may have left the response in any state, so the connection can't be reused
+		if panicked {
+			if !w.Written() {
+				w.SetKeepAlive(false)
+				response.WriteStatus(w, response.StatusInternalError, nil)
+			}
+			return
+		}
+
+		if err := w.Finish(); err != nil {
+			log.Printf("Error finishing response: %v", err)
+			return
+		}
+
+		// The next request starts after whatever the handler left of this body
+		if err := req.BodyReader.Close(); err != nil {
+			log.Printf("Error discarding request body: %v", err)
+			return
+		}
+
+		// A shutdown that started during the handler closes the connection now
+		if !w.KeepAlive() || !s.enabled.Load() {
+			return
+		}
+
+		conn.SetWriteDeadline(time.Time{})
+	}
+}
+
+// Runs the handler, recovering from a panic so that it only takes down
+// its own connection. Reports whether the handler panicked.
+func (s *Server) runHandler(w *response.Writer, req *request.Request) (panicked bool) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			panicked = true
+			s.reportPanic(req, recovered)
+		}
+	}()
+
+	s.handler(w, req)
+	return false
+}
+
+// Logs a recovered panic with the stack of the panicking goroutine and
+// passes it on to OnPanic. Must be called from the deferred function.
+func (s *Server) reportPanic(req *request.Request, recovered any) {
+	stack := debug.Stack()
+	if req != nil {
+		log.Printf("Panic serving %s %s: %v\n%s", req.RequestLine.Method, req.RequestLine.RequestTarget, recovered, stack)
+	} else {
+		log.Printf("Panic serving connection: %v\n%s", recovered, stack)
+	}
+
+	if s.OnPanic != nil {
+		s.OnPanic(req, recovered, stack)
+	}
+}
+
+// Blocks until the next request starts arriving, reporting false when the
+// client closed the connection or it stayed idle too long. The first
+// request on a connection must arrive within the header timeout.
+func (s *Server) waitForRequest(conn net.Conn, reader *bufio.Reader, first bool, accepted time.Time) bool {
+	if !s.setConnState(conn, connStateIdle) {
+		return false
+	}
+
+	if first {
+		setReadDeadline(conn, accepted, s.headerTimeout())
+	} else {
+		setReadDeadline(conn, time.Now(), s.IdleTimeout)
+	}
+
+	_, err := reader.Peek(1)
 	if err != nil {
-		log.Printf("Error writing response: %v", err)
+		if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) && !isTimeout(err) {
+			log.Printf("Error reading from connection: %v", err)
+		}
+		return false
+	}
+
+	return s.setConnState(conn, connStateActive)
+}
+
+// Returns the context of a single request, which expires with the WriteTimeout
+func (s *Server) requestContext(connCtx context.Context) (context.Context, context.CancelFunc) {
+	if s.WriteTimeout > 0 {
+		return context.WithTimeout(connCtx, s.WriteTimeout)
+	}
+	return context.WithCancel(connCtx)
+}
+
+// Watches conn in the background while a handler runs and cancels the
+// request context if the client disconnects. Data from a pipelined request
+// stays buffered in reader. The returned function stops watching and must
+// be called before reader is used again.
+func watchConn(conn net.Conn, reader *bufio.Reader, cancel context.CancelFunc) func() {
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		_, err := reader.Peek(1)
+		if err != nil && !isTimeout(err) {
+			cancel()
+		}
+	}()
+
+	return func() {
+		// A deadline in the past unblocks the pending read
+		conn.SetReadDeadline(time.Unix(1, 0))
+		<-done
+	}
+}
+
+func (s *Server) headerTimeout() time.Duration {
+	if s.ReadHeaderTimeout > 0 {
+		return s.ReadHeaderTimeout
+	}
+	return s.ReadTimeout
+}
+
+// Sets the read deadline timeout after start, or clears it for a zero timeout
+func setReadDeadline(conn net.Conn, start time.Time, timeout time.Duration) {
+	if timeout <= 0 {
+		conn.SetReadDeadline(time.Time{})
+		return
 	}
+	conn.SetReadDeadline(start.Add(timeout))
+}
+
+// Answers a request that could not be read and closes the connection.
+// Requests that ran out of time get 408, other connection errors get no
+// response since the client is gone.
+func rejectRequest(conn net.Conn, w *response.Writer, err error) {
+	if isTimeout(err) {
+		response.WriteStatus(w, response.StatusRequestTimeout, nil)
+		return
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return
+	}
+
+	log.Printf("Error parsing request: %v", err)
+	response.WriteStatus(w, statusForError(err), nil)
+	closeWriteAndDrain(conn)
+}
+
+// Maps a request parsing error to the response status sent before closing the connection
+func statusForError(err error) response.StatusCode {
+	switch {
+	case errors.Is(err, request.ErrUnsupportedVersion):
+		return response.StatusHTTPVersionNotSupported
+	case errors.Is(err, request.ErrNotImplemented):
+		return response.StatusNotImplemented
+	case errors.Is(err, request.ErrURITooLong):
+		return response.StatusURITooLong
+	case errors.Is(err, request.ErrBodyTooLarge):
+		return response.StatusContentTooLarge
+	case errors.Is(err, headers.ErrHeaderTooLarge):
+		return response.StatusRequestHeaderFieldsTooLarge
+	default:
+		return response.StatusBadRequest
+	}
+}
+
+// Stops writing and discards what the client is still sending for a short
+// while, so closing the connection doesn't reset it before the client has
+// read the error response
+func closeWriteAndDrain(conn net.Conn) {
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		return
+	}
+
+	if err := tcpConn.CloseWrite(); err != nil {
+		return
+	}
+
+	tcpConn.SetReadDeadline(time.Now().Add(drainTimeout))
+	io.Copy(io.Discard, io.LimitReader(tcpConn, maxDrainBytes))
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
 }
@@ -0,0 +1,461 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"http-server/internal/headers"
+	"http-server/internal/request"
+	"http-server/internal/response"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func helloHandler(w *response.Writer, req *request.Request) {
+	body := []byte("hello " + req.RequestLine.RequestTarget)
+	w.WriteStatusLine(response.StatusSuccess)
+	w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+	w.WriteBody(body)
+}
+
+// startServer serves handler on a random port and returns a connection to it
+func startServer(t *testing.T, handler Handler, opts ...Option) (*Server, net.Conn) {
+	t.Helper()
+
+	s, err := Serve(0, handler, opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+
+	conn, err := net.Dial("tcp", s.listener.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return s, conn
+}
+
+// readAll reads from conn until the server closes it
+func readAll(t *testing.T, conn net.Conn) string {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	data, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	return string(data)
+}
+
+// Connection Tests
+func TestServer_PipelinedRequests(t *testing.T) {
+	_, conn := startServer(t, helloHandler)
+
+	_, err := conn.Write([]byte("GET /one HTTP/1.1\r\nHost: localhost\r\n\r\n" +
+		"GET /two HTTP/1.1\r\nHost: localhost\r\n\r\n" +
+		"GET /three HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n"))
+	require.NoError(t, err)
+
+	out := readAll(t, conn)
+	assert.Equal(t, 3, strings.Count(out, "HTTP/1.1 200 OK\r\n"))
+	assert.Less(t, strings.Index(out, "hello /one"), strings.Index(out, "hello /two"))
+	assert.Less(t, strings.Index(out, "hello /two"), strings.Index(out, "hello /three"))
+	assert.Equal(t, 1, strings.Count(out, "Connection: close\r\n"))
+}
+
+func TestServer_MaxRequestsPerConn(t *testing.T) {
+	_, conn := startServer(t, helloHandler, func(s *Server) { s.MaxRequestsPerConn = 2 })
+
+	_, err := conn.Write([]byte("GET /one HTTP/1.1\r\nHost: localhost\r\n\r\n" +
+		"GET /two HTTP/1.1\r\nHost: localhost\r\n\r\n" +
+		"GET /three HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+
+	out := readAll(t, conn)
+	assert.Equal(t, 2, strings.Count(out, "HTTP/1.1 200 OK\r\n"))
+	assert.NotContains(t, out, "hello /three")
+}
+
+func TestServer_HeadRequestOmitsBody(t *testing.T) {
+	_, conn := startServer(t, helloHandler)
+
+	_, err := conn.Write([]byte("HEAD /one HTTP/1.1\r\nHost: localhost\r\n\r\n" +
+		"GET /two HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n"))
+	require.NoError(t, err)
+
+	out := readAll(t, conn)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 10\r\nContent-Type: text/plain\r\n\r\n"+
+		"HTTP/1.1 200 OK\r\nConnection: close\r\nContent-Length: 10\r\nContent-Type: text/plain\r\n\r\nhello /two", out)
+}
+
+func TestServer_EmptyHandlerResponse(t *testing.T) {
+	_, conn := startServer(t, func(w *response.Writer, req *request.Request) {})
+
+	_, err := conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n"))
+	require.NoError(t, err)
+
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nConnection: close\r\nContent-Length: 0\r\nContent-Type: text/plain\r\n\r\n", readAll(t, conn))
+}
+
+// Error Response Tests
+func TestServer_ParseErrorStatus(t *testing.T) {
+	testCases := []struct {
+		name     string
+		data     string
+		expected string
+	}{
+		{name: "malformed request line", data: "GET /\r\n\r\n", expected: "HTTP/1.1 400 Bad Request\r\n"},
+		{name: "malformed escape in target", data: "GET /%zz HTTP/1.1\r\nHost: localhost\r\n\r\n", expected: "HTTP/1.1 400 Bad Request\r\n"},
+		{name: "unsupported version", data: "GET / HTTP/2.0\r\n\r\n", expected: "HTTP/1.1 505 HTTP Version Not Supported\r\n"},
+		{name: "unsupported transfer coding", data: "POST / HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: gzip\r\n\r\n", expected: "HTTP/1.1 501 Not Implemented\r\n"},
+		{name: "body too large", data: "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 999999999\r\n\r\n", expected: "HTTP/1.1 413 Content Too Large\r\n"},
+		{name: "request line too long", data: "GET /" + strings.Repeat("a", 9000) + " HTTP/1.1\r\n", expected: "HTTP/1.1 414 URI Too Long\r\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, conn := startServer(t, helloHandler)
+
+			_, err := conn.Write([]byte(tc.data))
+			require.NoError(t, err)
+
+			out := readAll(t, conn)
+			assert.True(t, strings.HasPrefix(out, tc.expected), out)
+			assert.Contains(t, out, "Connection: close\r\n")
+		})
+	}
+}
+
+func TestServer_LimitsLargerThanReadBuffer(t *testing.T) {
+	limits := request.DefaultLimits
+	limits.MaxHeaderBytes = 2 * readBufferSize
+	_, conn := startServer(t, helloHandler, func(s *Server) { s.Limits = limits })
+
+	_, err := conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n" +
+		"Cookie: " + strings.Repeat("c", readBufferSize+1) + "\r\n\r\n"))
+	require.NoError(t, err)
+
+	out := readAll(t, conn)
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 200 OK\r\n"), out)
+}
+
+// Timeout Tests
+func TestServer_ReadHeaderTimeout(t *testing.T) {
+	_, conn := startServer(t, helloHandler, func(s *Server) { s.ReadHeaderTimeout = 100 * time.Millisecond })
+
+	_, err := conn.Write([]byte("GET / HTTP/1.1\r\nHost: loc"))
+	require.NoError(t, err)
+
+	out := readAll(t, conn)
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 408 Request Timeout\r\n"), out)
+}
+
+func TestServer_ReadTimeoutDuringBody(t *testing.T) {
+	_, conn := startServer(t, helloHandler, func(s *Server) { s.ReadTimeout = 100 * time.Millisecond })
+
+	_, err := conn.Write([]byte("POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 10\r\n\r\nhello"))
+	require.NoError(t, err)
+
+	out := readAll(t, conn)
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 408 Request Timeout\r\n"), out)
+}
+
+func TestServer_IdleTimeout(t *testing.T) {
+	_, conn := startServer(t, helloHandler, func(s *Server) { s.IdleTimeout = 100 * time.Millisecond })
+
+	_, err := conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n", line)
+
+	start := time.Now()
+	_, err = io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
+
+// Shutdown Tests
+func TestServer_ShutdownWaitsForInFlightRequests(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	s, conn := startServer(t, func(w *response.Writer, req *request.Request) {
+		close(started)
+		<-release
+		helloHandler(w, req)
+	})
+
+	_, err := conn.Write([]byte("GET /slow HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	<-started
+
+	done := make(chan error)
+	go func() { done <- s.Shutdown(context.Background()) }()
+
+	select {
+	case <-done:
+		t.Fatal("Shutdown returned while a request was in flight")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+	require.NoError(t, <-done)
+
+	assert.Contains(t, readAll(t, conn), "hello /slow")
+}
+
+func TestServer_ShutdownClosesIdleConnections(t *testing.T) {
+	s, conn := startServer(t, helloHandler)
+
+	_, err := conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	reader := bufio.NewReader(conn)
+	_, err = reader.ReadString('\n')
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, s.Shutdown(ctx))
+
+	_, err = io.ReadAll(reader)
+	require.NoError(t, err)
+}
+
+func TestServer_ShutdownDeadlineForcesClose(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	started := make(chan struct{})
+	s, conn := startServer(t, func(w *response.Writer, req *request.Request) {
+		close(started)
+		<-release
+	})
+
+	_, err := conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, s.Shutdown(ctx), context.DeadlineExceeded)
+
+	assert.Empty(t, readAll(t, conn))
+}
+
+func TestServer_RegisterOnShutdown(t *testing.T) {
+	s, _ := startServer(t, helloHandler)
+
+	called := make(chan struct{})
+	s.RegisterOnShutdown(func() { close(called) })
+	require.NoError(t, s.Shutdown(context.Background()))
+
+	select {
+	case <-called:
+	case <-time.After(time.Second):
+		t.Fatal("shutdown hook was not called")
+	}
+}
+
+// Request Context Tests
+func TestServer_ContextCancelledOnDisconnect(t *testing.T) {
+	cancelled := make(chan error, 1)
+	_, conn := startServer(t, func(w *response.Writer, req *request.Request) {
+		select {
+		case <-req.Context().Done():
+			cancelled <- req.Context().Err()
+		case <-time.After(5 * time.Second):
+			cancelled <- nil
+		}
+	})
+
+	_, err := conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	time.Sleep(50 * time.Millisecond)
+	conn.Close()
+
+	require.ErrorIs(t, <-cancelled, context.Canceled)
+}
+
+func TestServer_ContextNotCancelledByPipelinedRequest(t *testing.T) {
+	_, conn := startServer(t, func(w *response.Writer, req *request.Request) {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-time.After(100 * time.Millisecond):
+		}
+		helloHandler(w, req)
+	})
+
+	_, err := conn.Write([]byte("GET /one HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	time.Sleep(20 * time.Millisecond)
+	_, err = conn.Write([]byte("GET /two HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n"))
+	require.NoError(t, err)
+
+	out := readAll(t, conn)
+	assert.Contains(t, out, "hello /one")
+	assert.Contains(t, out, "hello /two")
+}
+
+func TestServer_ContextDeadlineFromWriteTimeout(t *testing.T) {
+	_, conn := startServer(t, func(w *response.Writer, req *request.Request) {
+		_, ok := req.Context().Deadline()
+		assert.True(t, ok)
+		helloHandler(w, req)
+	}, func(s *Server) { s.WriteTimeout = time.Second })
+
+	_, err := conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n"))
+	require.NoError(t, err)
+	assert.Contains(t, readAll(t, conn), "hello /")
+}
+
+func TestServer_ContextCancelledOnClose(t *testing.T) {
+	started := make(chan struct{})
+	cancelled := make(chan error, 1)
+	s, conn := startServer(t, func(w *response.Writer, req *request.Request) {
+		close(started)
+		<-req.Context().Done()
+		cancelled <- req.Context().Err()
+	})
+
+	_, err := conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	<-started
+	require.NoError(t, s.Close())
+
+	select {
+	case err := <-cancelled:
+		require.ErrorIs(t, err, context.Canceled)
+	case <-time.After(5 * time.Second):
+		t.Fatal("request context was not cancelled")
+	}
+}
+
+// Panic Tests
+func TestServer_PanicBeforeResponse(t *testing.T) {
+	type report struct {
+		target    string
+		recovered any
+	}
+	reports := make(chan report, 1)
+
+	s, conn := startServer(t, func(w *response.Writer, req *request.Request) {
+		panic("boom")
+	}, func(s *Server) {
+		s.OnPanic = func(req *request.Request, recovered any, stack []byte) {
+			assert.Contains(t, string(stack), "runHandler")
+			reports <- report{req.RequestLine.RequestTarget, recovered}
+		}
+	})
+
+	_, err := conn.Write([]byte("GET /panic HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+
+	out := readAll(t, conn)
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 500 Internal Server Error\r\n"), out)
+	assert.Contains(t, out, "Connection: close\r\n")
+	assert.Equal(t, report{"/panic", "boom"}, <-reports)
+
+	// The server keeps serving other connections
+	conn2, err := net.Dial("tcp", s.listener.Addr().String())
+	require.NoError(t, err)
+	defer conn2.Close()
+	_, err = conn2.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	line, err := bufio.NewReader(conn2).ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 500 Internal Server Error\r\n", line)
+}
+
+func TestServer_PanicAfterHeaders(t *testing.T) {
+	_, conn := startServer(t, func(w *response.Writer, req *request.Request) {
+		w.WriteStatusLine(response.StatusSuccess)
+		w.WriteHeaders(response.GetDefaultHeaders(10))
+		w.WriteBody([]byte("part"))
+		panic("boom")
+	})
+
+	_, err := conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+
+	out := readAll(t, conn)
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 200 OK\r\n"), out)
+	assert.True(t, strings.HasSuffix(out, "\r\n\r\npart"), out)
+	assert.NotContains(t, out, "500")
+}
+
+func TestServer_PanicInBeforeWriteHeaders(t *testing.T) {
+	reports := make(chan any, 1)
+	s, conn := startServer(t, func(w *response.Writer, req *request.Request) {
+		if req.URL.Path != "/panic" {
+			helloHandler(w, req)
+			return
+		}
+		// Only runs once the server finishes the empty response
+		w.BeforeWriteHeaders(func(*headers.Headers) { panic("boom") })
+	}, func(s *Server) {
+		s.OnPanic = func(req *request.Request, recovered any, stack []byte) {
+			assert.Contains(t, string(stack), "Finish")
+			reports <- recovered
+		}
+	})
+
+	_, err := conn.Write([]byte("GET /panic HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+
+	// The status line was already sent when the hook ran
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n", readAll(t, conn))
+	assert.Equal(t, "boom", <-reports)
+
+	// The server keeps serving other connections
+	conn2, err := net.Dial("tcp", s.listener.Addr().String())
+	require.NoError(t, err)
+	defer conn2.Close()
+	_, err = conn2.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n"))
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(readAll(t, conn2), "hello /"))
+}
+
+// Form Tests
+func TestServer_RemovesMultipartFiles(t *testing.T) {
+	testRemovesMultipartFiles(t)
+}
+
+func TestServer_RemovesMultipartFilesParsedOnRequestCopy(t *testing.T) {
+	type key struct{}
+	withValue := func(next Handler) Handler {
+		return func(w *response.Writer, req *request.Request) {
+			next(w, req.WithContext(context.WithValue(req.Context(), key{}, "value")))
+		}
+	}
+
+	testRemovesMultipartFiles(t, func(s *Server) { s.Middleware = []Middleware{withValue} })
+}
+
+func testRemovesMultipartFiles(t *testing.T, opts ...Option) {
+	t.Helper()
+
+	spooled := make(chan string, 1)
+	_, conn := startServer(t, func(w *response.Writer, req *request.Request) {
+		require.NoError(t, req.ParseMultipartForm(request.MultipartLimits{}))
+		f, err := req.MultipartForm.File["upload"][0].Open()
+		require.NoError(t, err)
+		defer f.Close()
+		spooled <- f.(*os.File).Name()
+	}, opts...)
+
+	body := "--b\r\nContent-Disposition: form-data; name=\"upload\"; filename=\"a.txt\"\r\n\r\ncontent\r\n--b--\r\n"
+	_, err := conn.Write([]byte("POST /upload HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n" +
+		"Content-Type: multipart/form-data; boundary=b\r\nContent-Length: " + strconv.Itoa(len(body)) + "\r\n\r\n" + body))
+	require.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(readAll(t, conn), "HTTP/1.1 200 OK\r\n"))
+	_, err = os.Stat(<-spooled)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -0,0 +1,207 @@
+package session
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// FileStore keeps each session in a file named after its ID, so sessions
+// survive restarts and can be shared by processes on one host. Files are
+// encrypted with AES-256-GCM, so whoever can read the directory can
+// neither read nor forge session data.
+type FileStore struct {
+	dir   string
+	aeads []cipher.AEAD
+}
+
+type fileEntry struct {
+	Data    map[string]string `json:"data"`
+	Expires time.Time         `json:"expires"`
+}
+
+const fileSuffix = ".session"
+
+// NewFileStore returns a store writing to dir, which is created if needed.
+// Sessions are encrypted with the first key and decrypted with any of
+// them, so keys are rotated like the Manager's and the same keys can be
+// passed to both.
+func NewFileStore(dir string, keys ...[]byte) (*FileStore, error) {
+	if err := validateKeys(keys); err != nil {
+		return nil, err
+	}
+
+	aeads := make([]cipher.AEAD, len(keys))
+	for i, key := range keys {
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create session cipher: %w", err)
+		}
+		aeads[i] = aead
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("unable to create session directory: %w", err)
+	}
+	return &FileStore{dir: dir, aeads: aeads}, nil
+}
+
+// Derives the encryption key from key, so a key shared with the Manager
+// never both signs and encrypts
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("session file encryption"))
+
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (s *FileStore) Load(id string) (map[string]string, bool, error) {
+	path, err := s.path(id)
+	if err != nil {
+		return nil, false, err
+	}
+
+	sealed, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	// Files encrypted with a dropped key or tampered with are as good as missing
+	content, ok := s.open(id, sealed)
+	if !ok {
+		return nil, false, s.Delete(id)
+	}
+
+	var entry fileEntry
+	if err := json.Unmarshal(content, &entry); err != nil {
+		return nil, false, fmt.Errorf("corrupt session file %s: %w", path, err)
+	}
+
+	if !time.Now().Before(entry.Expires) {
+		return nil, false, s.Delete(id)
+	}
+
+	if entry.Data == nil {
+		entry.Data = make(map[string]string)
+	}
+	return entry.Data, true, nil
+}
+
+// Save writes the session to a temporary file first, so a concurrent
+// Load never sees a partially written session
+func (s *FileStore) Save(id string, data map[string]string, expires time.Time) error {
+	path, err := s.path(id)
+	if err != nil {
+		return err
+	}
+
+	content, err := json.Marshal(fileEntry{Data: data, Expires: expires})
+	if err != nil {
+		return err
+	}
+
+	sealed, err := s.seal(id, content)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(s.dir, "tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(sealed); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *FileStore) Delete(id string) error {
+	path, err := s.path(id)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Cleanup removes the files of expired sessions. Run it periodically,
+// since expired sessions are otherwise only removed when they are loaded.
+func (s *FileStore) Cleanup() error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), fileSuffix)
+		if !ok {
+			continue
+		}
+		// Loading removes the file when it expired
+		if _, _, err := s.Load(id); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Encrypts content with the first key. Binding the ID as additional data
+// keeps a file from being passed off as another session.
+func (s *FileStore) seal(id string, content []byte) ([]byte, error) {
+	aead := s.aeads[0]
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(content)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, content, []byte(id)), nil
+}
+
+// Decrypts a sealed file with any of the keys
+func (s *FileStore) open(id string, sealed []byte) ([]byte, bool) {
+	for _, aead := range s.aeads {
+		if len(sealed) < aead.NonceSize() {
+			return nil, false
+		}
+		nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+		if content, err := aead.Open(nil, nonce, ciphertext, []byte(id)); err == nil {
+			return content, true
+		}
+	}
+	return nil, false
+}
+
+// Returns the file of a session, rejecting IDs that could escape the directory
+func (s *FileStore) path(id string) (string, error) {
+	if !validID(id) {
+		return "", fmt.Errorf("invalid session ID %q", id)
+	}
+	return filepath.Join(s.dir, id+fileSuffix), nil
+}
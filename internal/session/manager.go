@@ -0,0 +1,229 @@
+package session
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"http-server/internal/headers"
+	"http-server/internal/request"
+	"http-server/internal/response"
+	"http-server/internal/server"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	defaultCookieName = "session"
+	defaultTTL        = 24 * time.Hour
+	// Keys shorter than the HMAC-SHA256 output weaken the signature
+	minKeyLength = 32
+	idLength     = 32
+)
+
+// Manager issues session cookies and loads and saves sessions around
+// each request. The cookie only carries the session ID, signed with HMAC-SHA256.
+type Manager struct {
+	// CookieName is the name of the session cookie
+	CookieName string
+	// TTL is how long a session lives after the last request that used it
+	TTL time.Duration
+	// Path, Domain, Secure and SameSite are set on the session cookie,
+	// which is always HttpOnly
+	Path     string
+	Domain   string
+	Secure   bool
+	SameSite response.SameSite
+
+	store Store
+	keys  [][]byte
+}
+
+// NewManager returns a manager storing sessions in store. Cookies are
+// signed with the first key and accepted when signed with any of them, so
+// keys can be rotated by adding a new key in front and dropping the last
+// one once its cookies have been re-signed or expired.
+func NewManager(store Store, keys ...[]byte) (*Manager, error) {
+	if store == nil {
+		return nil, fmt.Errorf("invalid session store: store must not be nil")
+	}
+
+	if err := validateKeys(keys); err != nil {
+		return nil, err
+	}
+
+	return &Manager{
+		CookieName: defaultCookieName,
+		TTL:        defaultTTL,
+		Path:       "/",
+		SameSite:   response.SameSiteLax,
+		store:      store,
+		keys:       keys,
+	}, nil
+}
+
+func validateKeys(keys [][]byte) error {
+	if len(keys) == 0 {
+		return fmt.Errorf("invalid session keys: at least one key is required")
+	}
+
+	for i, key := range keys {
+		if len(key) < minKeyLength {
+			return fmt.Errorf("invalid session key %d: keys must be at least %d bytes", i, minKeyLength)
+		}
+	}
+	return nil
+}
+
+// Middleware attaches the client's session to the request, available
+// from FromRequest, and saves it once the handler returns. Requests
+// without a valid session cookie get a new session, whose cookie is only
+// issued once data is stored in it. Cookie changes are sent with the
+// response headers, so a new or regenerated session must be set up before
+// the handler writes them.
+func (m *Manager) Middleware(next server.Handler) server.Handler {
+	return func(w *response.Writer, req *request.Request) {
+		s, sentID, resign := m.load(req)
+		if s == nil {
+			response.WriteStatus(w, response.StatusInternalError, nil)
+			return
+		}
+
+		w.BeforeWriteHeaders(func(h *headers.Headers) {
+			m.setCookie(h, s, sentID, resign)
+		})
+
+		next(w, withSession(req, s))
+
+		if err := m.save(s); err != nil {
+			log.Printf("Error saving session: %v", err)
+		}
+	}
+}
+
+// Loads the session named by the request's cookie, or starts a new one.
+// Also returns the ID the client sent and whether its cookie was signed
+// with an old key. The session is nil when the store failed.
+func (m *Manager) load(req *request.Request) (*Session, string, bool) {
+	cookie, err := req.Cookie(m.CookieName)
+	if err == nil {
+		id, keyIndex, ok := m.verify(cookie.Value)
+		if ok {
+			data, found, err := m.store.Load(id)
+			if err != nil {
+				log.Printf("Error loading session: %v", err)
+				return nil, "", false
+			}
+			if found {
+				return &Session{id: id, data: data, stored: true}, id, keyIndex > 0
+			}
+		}
+	}
+
+	id, err := newID()
+	if err != nil {
+		log.Printf("Error creating session ID: %v", err)
+		return nil, "", false
+	}
+	return newSession(id), "", false
+}
+
+func (m *Manager) save(s *Session) error {
+	for _, id := range s.oldIDs {
+		if err := m.store.Delete(id); err != nil {
+			return err
+		}
+	}
+	s.oldIDs = nil
+
+	if s.destroyed {
+		return m.store.Delete(s.id)
+	}
+
+	if !s.persist() {
+		return nil
+	}
+
+	return m.store.Save(s.id, s.data, time.Now().Add(m.TTL))
+}
+
+// Adds a Set-Cookie field when the client's cookie no longer matches the session
+func (m *Manager) setCookie(h *headers.Headers, s *Session, sentID string, resign bool) {
+	cookie := &response.Cookie{
+		Name:     m.CookieName,
+		Path:     m.Path,
+		Domain:   m.Domain,
+		Secure:   m.Secure,
+		HttpOnly: true,
+		SameSite: m.SameSite,
+	}
+
+	switch {
+	case !s.persist():
+		if sentID == "" {
+			return
+		}
+		cookie.MaxAge = -1
+	case s.id != sentID || resign:
+		cookie.Value = m.sign(s.id)
+	default:
+		return
+	}
+
+	if err := response.SetCookie(h, cookie); err != nil {
+		log.Printf("Error setting session cookie: %v", err)
+	}
+}
+
+// Returns id followed by its signature with the current key
+func (m *Manager) sign(id string) string {
+	return id + "." + signature(m.keys[0], m.CookieName, id)
+}
+
+// Returns the ID from a signed cookie value and the index of the key that
+// signed it
+func (m *Manager) verify(value string) (string, int, bool) {
+	id, sig, ok := strings.Cut(value, ".")
+	if !ok || !validID(id) {
+		return "", 0, false
+	}
+
+	for i, key := range m.keys {
+		if hmac.Equal([]byte(sig), []byte(signature(key, m.CookieName, id))) {
+			return id, i, true
+		}
+	}
+	return "", 0, false
+}
+
+// Signs the cookie name along with the ID so a signed value can't be
+// replayed as another cookie
+func signature(key []byte, name, id string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(name + "=" + id))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func newID() (string, error) {
+	b := make([]byte, idLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Reports whether id has the form of a generated ID
+func validID(id string) bool {
+	if len(id) != base64.RawURLEncoding.EncodedLen(idLength) {
+		return false
+	}
+
+	for _, c := range []byte(id) {
+		if !(c >= 'a' && c <= 'z') && !(c >= 'A' && c <= 'Z') && !(c >= '0' && c <= '9') && c != '-' && c != '_' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,215 @@
+package session
+
+import (
+	"bytes"
+	"http-server/internal/request"
+	"http-server/internal/response"
+	"http-server/internal/server"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	testKey  = bytes.Repeat([]byte("k"), 32)
+	otherKey = bytes.Repeat([]byte("o"), 32)
+)
+
+var setCookiePattern = regexp.MustCompile(`Set-Cookie: session=([^;\r]*)([^\r]*)\r\n`)
+
+// serve runs a request carrying cookie through the manager's middleware
+// and returns the raw response
+func serve(t *testing.T, m *Manager, cookie string, handler server.Handler) string {
+	t.Helper()
+
+	raw := "GET / HTTP/1.1\r\nHost: localhost\r\n"
+	if cookie != "" {
+		raw += "Cookie: session=" + cookie + "\r\n"
+	}
+	req, err := request.RequestFromReader(strings.NewReader(raw + "\r\n"))
+	require.NoError(t, err)
+
+	buf := &bytes.Buffer{}
+	w := response.NewWriter(buf)
+	m.Middleware(handler)(w, req)
+	require.NoError(t, w.Finish())
+
+	return buf.String()
+}
+
+// sessionCookie returns the value and attributes of the session cookie set by a response
+func sessionCookie(out string) (string, string, bool) {
+	match := setCookiePattern.FindStringSubmatch(out)
+	if match == nil {
+		return "", "", false
+	}
+	return match[1], match[2], true
+}
+
+func newTestManager(t *testing.T, keys ...[]byte) (*Manager, *MemoryStore) {
+	t.Helper()
+
+	store := NewMemoryStore(0)
+	m, err := NewManager(store, keys...)
+	require.NoError(t, err)
+	return m, store
+}
+
+func TestNewManager_InvalidKeys(t *testing.T) {
+	_, err := NewManager(NewMemoryStore(0))
+	require.Error(t, err)
+
+	_, err = NewManager(NewMemoryStore(0), []byte("short"))
+	require.Error(t, err)
+
+	_, err = NewManager(nil, testKey)
+	require.Error(t, err)
+}
+
+func TestManager_IssuesCookieOnlyWhenDataIsStored(t *testing.T) {
+	m, store := newTestManager(t, testKey)
+
+	out := serve(t, m, "", func(w *response.Writer, req *request.Request) {
+		require.NotNil(t, FromRequest(req))
+	})
+	_, _, ok := sessionCookie(out)
+	assert.False(t, ok, out)
+	assert.Equal(t, 0, store.Len())
+
+	out = serve(t, m, "", func(w *response.Writer, req *request.Request) {
+		FromRequest(req).Set("user", "ada")
+	})
+	value, attrs, ok := sessionCookie(out)
+	require.True(t, ok, out)
+	assert.Equal(t, "; Path=/; HttpOnly; SameSite=Lax", attrs)
+	assert.Equal(t, 1, store.Len())
+
+	// The next request with the cookie sees the data and needs no new cookie
+	out = serve(t, m, value, func(w *response.Writer, req *request.Request) {
+		assert.Equal(t, "ada", FromRequest(req).Get("user"))
+	})
+	_, _, ok = sessionCookie(out)
+	assert.False(t, ok, out)
+}
+
+func TestManager_RejectsTamperedCookies(t *testing.T) {
+	m, _ := newTestManager(t, testKey)
+
+	out := serve(t, m, "", func(w *response.Writer, req *request.Request) {
+		FromRequest(req).Set("user", "ada")
+	})
+	value, _, _ := sessionCookie(out)
+	id, sig, _ := strings.Cut(value, ".")
+
+	forged, err := newID()
+	require.NoError(t, err)
+
+	for _, cookie := range []string{id, id + ".", forged + "." + sig, id + "." + sig[1:] + "A", "../../etc/passwd." + sig} {
+		serve(t, m, cookie, func(w *response.Writer, req *request.Request) {
+			s := FromRequest(req)
+			assert.NotEqual(t, id, s.ID(), cookie)
+			assert.Empty(t, s.Get("user"), cookie)
+		})
+	}
+}
+
+func TestManager_KeyRotation(t *testing.T) {
+	old, store := newTestManager(t, otherKey)
+	out := serve(t, old, "", func(w *response.Writer, req *request.Request) {
+		FromRequest(req).Set("user", "ada")
+	})
+	oldValue, _, _ := sessionCookie(out)
+
+	rotated, err := NewManager(store, testKey, otherKey)
+	require.NoError(t, err)
+
+	// A cookie signed with the old key is accepted and re-signed with the new one
+	out = serve(t, rotated, oldValue, func(w *response.Writer, req *request.Request) {
+		assert.Equal(t, "ada", FromRequest(req).Get("user"))
+	})
+	newValue, _, ok := sessionCookie(out)
+	require.True(t, ok, out)
+	assert.NotEqual(t, oldValue, newValue)
+
+	// Once the old key is dropped only the re-signed cookie is accepted
+	current, err := NewManager(store, testKey)
+	require.NoError(t, err)
+	serve(t, current, oldValue, func(w *response.Writer, req *request.Request) {
+		assert.Empty(t, FromRequest(req).Get("user"))
+	})
+	serve(t, current, newValue, func(w *response.Writer, req *request.Request) {
+		assert.Equal(t, "ada", FromRequest(req).Get("user"))
+	})
+}
+
+func TestManager_Regenerate(t *testing.T) {
+	m, store := newTestManager(t, testKey)
+
+	out := serve(t, m, "", func(w *response.Writer, req *request.Request) {
+		FromRequest(req).Set("cart", "3 items")
+	})
+	before, _, _ := sessionCookie(out)
+	beforeID, _, _ := strings.Cut(before, ".")
+
+	out = serve(t, m, before, func(w *response.Writer, req *request.Request) {
+		s := FromRequest(req)
+		require.NoError(t, s.Regenerate())
+		s.Set("user", "ada")
+	})
+	after, _, ok := sessionCookie(out)
+	require.True(t, ok, out)
+	afterID, _, _ := strings.Cut(after, ".")
+	assert.NotEqual(t, beforeID, afterID)
+
+	_, found, err := store.Load(beforeID)
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	data, found, err := store.Load(afterID)
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, map[string]string{"cart": "3 items", "user": "ada"}, data)
+}
+
+func TestManager_Destroy(t *testing.T) {
+	m, store := newTestManager(t, testKey)
+
+	out := serve(t, m, "", func(w *response.Writer, req *request.Request) {
+		FromRequest(req).Set("user", "ada")
+	})
+	value, _, _ := sessionCookie(out)
+
+	out = serve(t, m, value, func(w *response.Writer, req *request.Request) {
+		FromRequest(req).Destroy()
+	})
+	deleted, attrs, ok := sessionCookie(out)
+	require.True(t, ok, out)
+	assert.Empty(t, deleted)
+	assert.Contains(t, attrs, "; Max-Age=0")
+	assert.Equal(t, 0, store.Len())
+}
+
+func TestManager_SessionExpires(t *testing.T) {
+	m, _ := newTestManager(t, testKey)
+	m.TTL = 50 * time.Millisecond
+
+	out := serve(t, m, "", func(w *response.Writer, req *request.Request) {
+		FromRequest(req).Set("user", "ada")
+	})
+	value, _, _ := sessionCookie(out)
+
+	time.Sleep(100 * time.Millisecond)
+	serve(t, m, value, func(w *response.Writer, req *request.Request) {
+		assert.Empty(t, FromRequest(req).Get("user"))
+	})
+}
+
+func TestFromRequest_WithoutMiddleware(t *testing.T) {
+	req, err := request.RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	assert.Nil(t, FromRequest(req))
+}
@@ -0,0 +1,90 @@
+package session
+
+import (
+	"context"
+	"http-server/internal/request"
+	"maps"
+)
+
+type contextKey struct{}
+
+// Session holds the data of one client across requests. It is only used
+// by the request it was loaded for and is not safe for concurrent use.
+type Session struct {
+	id   string
+	data map[string]string
+	// Whether the session was loaded from the store, as opposed to created for this request
+	stored bool
+	// IDs no longer valid after Regenerate, deleted from the store when the request ends
+	oldIDs      []string
+	destroyed   bool
+	regenerated bool
+}
+
+func newSession(id string) *Session {
+	return &Session{id: id, data: make(map[string]string)}
+}
+
+// FromRequest returns the session attached to req by Manager.Middleware,
+// or nil if there is none
+func FromRequest(req *request.Request) *Session {
+	s, _ := req.Context().Value(contextKey{}).(*Session)
+	return s
+}
+
+func withSession(req *request.Request, s *Session) *request.Request {
+	return req.WithContext(context.WithValue(req.Context(), contextKey{}, s))
+}
+
+// ID returns the current session ID
+func (s *Session) ID() string {
+	return s.id
+}
+
+// Get returns the value stored under key, or an empty string
+func (s *Session) Get(key string) string {
+	return s.data[key]
+}
+
+// Set stores value under key
+func (s *Session) Set(key, value string) {
+	s.data[key] = value
+}
+
+// Delete removes key from the session
+func (s *Session) Delete(key string) {
+	delete(s.data, key)
+}
+
+// Values returns a copy of all data in the session
+func (s *Session) Values() map[string]string {
+	return maps.Clone(s.data)
+}
+
+// Regenerate moves the session data to a new ID and invalidates the old
+// one. Call it whenever the privileges of the session change, e.g. on
+// login, so an ID planted by an attacker before can't be used (session fixation).
+func (s *Session) Regenerate() error {
+	id, err := newID()
+	if err != nil {
+		return err
+	}
+
+	s.oldIDs = append(s.oldIDs, s.id)
+	s.id = id
+	s.regenerated = true
+	s.destroyed = false
+	return nil
+}
+
+// Destroy deletes the session from the store and expires its cookie
+func (s *Session) Destroy() {
+	s.destroyed = true
+	clear(s.data)
+}
+
+// Reports whether the session must be saved to the store, leaving fresh
+// sessions without data out of the store and the client's cookies
+func (s *Session) persist() bool {
+	return !s.destroyed && (s.stored || s.regenerated || len(s.data) > 0)
+}
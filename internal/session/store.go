@@ -0,0 +1,119 @@
+package session
+
+import (
+	"maps"
+	"sync"
+	"time"
+)
+
+// Store persists session data by ID. Implementations must be safe for
+// concurrent use.
+type Store interface {
+	// Load returns the data of an unexpired session and whether it was found
+	Load(id string) (data map[string]string, found bool, err error)
+	// Save creates or replaces a session, which expires at expires
+	Save(id string, data map[string]string, expires time.Time) error
+	// Delete removes a session. Deleting an unknown session is not an error.
+	Delete(id string) error
+}
+
+type memoryEntry struct {
+	data    map[string]string
+	expires time.Time
+}
+
+// MemoryStore keeps sessions in memory. Expired sessions are never
+// returned and are evicted in the background.
+type MemoryStore struct {
+	mu       sync.Mutex
+	sessions map[string]memoryEntry
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewMemoryStore returns a store that evicts expired sessions every
+// cleanupInterval until Close is called. A zero interval only evicts
+// sessions when they are loaded.
+func NewMemoryStore(cleanupInterval time.Duration) *MemoryStore {
+	s := &MemoryStore{
+		sessions: make(map[string]memoryEntry),
+		stop:     make(chan struct{}),
+	}
+
+	if cleanupInterval > 0 {
+		go s.evictEvery(cleanupInterval)
+	}
+
+	return s
+}
+
+func (s *MemoryStore) Load(id string) (map[string]string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.sessions[id]
+	if !ok {
+		return nil, false, nil
+	}
+
+	if !time.Now().Before(entry.expires) {
+		delete(s.sessions, id)
+		return nil, false, nil
+	}
+
+	return maps.Clone(entry.data), true, nil
+}
+
+func (s *MemoryStore) Save(id string, data map[string]string, expires time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sessions[id] = memoryEntry{data: maps.Clone(data), expires: expires}
+	return nil
+}
+
+func (s *MemoryStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions, id)
+	return nil
+}
+
+// Len returns the number of sessions held, including expired ones not evicted yet
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.sessions)
+}
+
+// Close stops the background eviction
+func (s *MemoryStore) Close() {
+	s.stopOnce.Do(func() { close(s.stop) })
+}
+
+func (s *MemoryStore) evictEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.evictExpired()
+		}
+	}
+}
+
+func (s *MemoryStore) evictExpired() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for id, entry := range s.sessions {
+		if !now.Before(entry.expires) {
+			delete(s.sessions, id)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package session
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testStore runs the behavior every Store must share
+func testStore(t *testing.T, store Store) {
+	t.Helper()
+
+	id, err := newID()
+	require.NoError(t, err)
+
+	_, found, err := store.Load(id)
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	data := map[string]string{"user": "ada"}
+	require.NoError(t, store.Save(id, data, time.Now().Add(time.Hour)))
+	data["user"] = "changed after save"
+
+	loaded, found, err := store.Load(id)
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, map[string]string{"user": "ada"}, loaded)
+
+	require.NoError(t, store.Save(id, map[string]string{}, time.Now().Add(-time.Second)))
+	_, found, err = store.Load(id)
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	require.NoError(t, store.Save(id, data, time.Now().Add(time.Hour)))
+	require.NoError(t, store.Delete(id))
+	require.NoError(t, store.Delete(id))
+	_, found, err = store.Load(id)
+	require.NoError(t, err)
+	assert.False(t, found)
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore(0)
+	testStore(t, store)
+}
+
+func TestMemoryStore_EvictsInBackground(t *testing.T) {
+	store := NewMemoryStore(10 * time.Millisecond)
+	defer store.Close()
+
+	require.NoError(t, store.Save("a", nil, time.Now().Add(20*time.Millisecond)))
+	require.NoError(t, store.Save("b", nil, time.Now().Add(time.Hour)))
+	assert.Equal(t, 2, store.Len())
+
+	assert.Eventually(t, func() bool { return store.Len() == 1 }, time.Second, 10*time.Millisecond)
+}
+
+func TestFileStore(t *testing.T) {
+	store, err := NewFileStore(filepath.Join(t.TempDir(), "sessions"), testKey)
+	require.NoError(t, err)
+	testStore(t, store)
+}
+
+func TestFileStore_Encrypts(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileStore(dir, testKey)
+	require.NoError(t, err)
+
+	id, _ := newID()
+	require.NoError(t, store.Save(id, map[string]string{"user": "ada"}, time.Now().Add(time.Hour)))
+
+	content, err := os.ReadFile(filepath.Join(dir, id+fileSuffix))
+	require.NoError(t, err)
+	assert.NotContains(t, string(content), "ada")
+	assert.NotContains(t, string(content), "user")
+
+	// A file copied to another ID doesn't decrypt
+	other, _ := newID()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, other+fileSuffix), content, 0o600))
+	_, found, err := store.Load(other)
+	require.NoError(t, err)
+	assert.False(t, found)
+}
+
+func TestFileStore_KeyRotation(t *testing.T) {
+	dir := t.TempDir()
+	old, err := NewFileStore(dir, otherKey)
+	require.NoError(t, err)
+
+	id, _ := newID()
+	require.NoError(t, old.Save(id, map[string]string{"user": "ada"}, time.Now().Add(time.Hour)))
+
+	rotated, err := NewFileStore(dir, testKey, otherKey)
+	require.NoError(t, err)
+	data, found, err := rotated.Load(id)
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, map[string]string{"user": "ada"}, data)
+
+	current, err := NewFileStore(dir, testKey)
+	require.NoError(t, err)
+	_, found, err = current.Load(id)
+	require.NoError(t, err)
+	assert.False(t, found)
+}
+
+func TestNewFileStore_InvalidKeys(t *testing.T) {
+	_, err := NewFileStore(t.TempDir())
+	assert.Error(t, err)
+
+	_, err = NewFileStore(t.TempDir(), []byte("short"))
+	assert.Error(t, err)
+}
+
+func TestFileStore_Cleanup(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileStore(dir, testKey)
+	require.NoError(t, err)
+
+	expired, _ := newID()
+	live, _ := newID()
+	require.NoError(t, store.Save(expired, nil, time.Now().Add(-time.Second)))
+	require.NoError(t, store.Save(live, nil, time.Now().Add(time.Hour)))
+
+	require.NoError(t, store.Cleanup())
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, live+fileSuffix, entries[0].Name())
+}
+
+func TestFileStore_RejectsInvalidIDs(t *testing.T) {
+	store, err := NewFileStore(t.TempDir(), testKey)
+	require.NoError(t, err)
+
+	for _, id := range []string{"", "../escape", "short"} {
+		_, _, err := store.Load(id)
+		assert.Error(t, err, id)
+		assert.Error(t, store.Save(id, nil, time.Now().Add(time.Hour)), id)
+	}
+}